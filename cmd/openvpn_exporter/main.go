@@ -14,52 +14,358 @@
 package main
 
 import (
+	"context"
 	"flag"
-	"log"
+	"fmt"
+	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
 	"strings"
+	"sync"
+	"syscall"
+	"time"
 
+	"github.com/kumina/openvpn_exporter/pkg/config"
+	"github.com/kumina/openvpn_exporter/pkg/discovery"
 	"github.com/kumina/openvpn_exporter/pkg/exporters"
+	"github.com/kumina/openvpn_exporter/pkg/formats"
+	"github.com/kumina/openvpn_exporter/pkg/logging"
+	"github.com/kumina/openvpn_exporter/pkg/probe"
+	"github.com/kumina/openvpn_exporter/pkg/pushgateway"
+	"github.com/kumina/openvpn_exporter/pkg/quota"
+	"github.com/kumina/openvpn_exporter/pkg/remotewrite"
+	"github.com/kumina/openvpn_exporter/pkg/sessions"
 	"github.com/kumina/openvpn_exporter/pkg/version"
+	"github.com/kumina/openvpn_exporter/pkg/webhook"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "report" {
+		runReport(os.Args[2:])
+		return
+	}
+
+	pushFlags := registerPushFlags(flag.CommandLine)
 	var (
-		listenAddress      = flag.String("web.listen-address", ":9176", "Address to listen on for web interface and telemetry.")
-		metricsPath        = flag.String("web.telemetry-path", "/metrics", "Path under which to expose metrics.")
-		openvpnStatusPaths = flag.String("openvpn.status_paths", "examples/version-2.3/client.status,examples/version-2.3/server2.status,examples/version-2.3/server3.status", "Paths at which OpenVPN places its status files.")
-		ignoreIndividuals  = flag.Bool("ignore.individuals", false, "If ignoring metrics for individuals")
-		openvpnVersion     = flag.String("openvpn.version", "2.3", "Version of OpenVPN to use (e.g., 2.3)")
-		showVersion        = flag.Bool("version", false, "Show version information and exit")
+		listenAddress        = flag.String("web.listen-address", ":9176", "Address to listen on for web interface and telemetry.")
+		metricsPath          = flag.String("web.telemetry-path", "/metrics", "Path under which to expose metrics.")
+		shutdownTimeout      = flag.Duration("web.shutdown_timeout", 30*time.Second, "Time to wait for in-flight requests to complete when shutting down.")
+		openvpnStatusPaths   = flag.String("openvpn.status_paths", "examples/version-2.3/client.status,examples/version-2.3/server2.status,examples/version-2.3/server3.status", "Paths at which OpenVPN places its status files.")
+		ignoreIndividuals    = flag.Bool("ignore.individuals", false, "If ignoring metrics for individuals")
+		ignoreRealPort       = flag.Bool("ignore.real_port", false, "If leaving the port of the real address of clients out of their labels, to reduce the number of series.")
+		openvpnVersion       = flag.String("openvpn.version", "2.3", "Version of OpenVPN to use (e.g., 2.3)")
+		openvpnConfigPaths   = flag.String("openvpn.config_paths", "", "Glob patterns of OpenVPN configuration files to discover status files, management interfaces and address pools from (e.g., /etc/openvpn/server/*.conf).")
+		configFile           = flag.String("config.file", "", "Path to the configuration file for settings such as webhooks.")
+		webhookInterval      = flag.Duration("webhook.poll_interval", 10*time.Second, "Interval at which client lists are compared to notify webhooks of clients connecting and disconnecting.")
+		quotaInterval        = flag.Duration("quota.poll_interval", 30*time.Second, "Interval at which the traffic of clients is accounted against their quotas.")
+		sessionsDBPath       = flag.String("sessions.db_path", "", "Record client sessions in the SQLite database at this path, for use with the report command.")
+		sessionsInterval     = flag.Duration("sessions.poll_interval", 30*time.Second, "Interval at which client lists are recorded in the session database.")
+		logLevel             = flag.String("log.level", "info", "Only log messages with the given severity or above (debug, info, warn or error).")
+		logFormat            = flag.String("log.format", "logfmt", "Output format of log messages (logfmt or json).")
+		logRateLimitInterval = flag.Duration("log.rate_limit_interval", time.Minute, "Interval within which repeated identical log messages are suppressed. Zero disables suppression.")
+		showVersion          = flag.Bool("version", false, "Show version information and exit")
+		outputTextfile       = flag.String("output.textfile", "", "Write metrics to this file for node_exporter's textfile collector instead of serving them over HTTP.")
+		outputInterval       = flag.Duration("output.interval", 0, "Interval at which the textfile is rewritten. If zero, it is written once.")
+		outputFormat         = flag.String("output.format", "prometheus", "Format of the textfile (prometheus, influx or graphite). A textfile of - writes to standard output, e.g. for Telegraf's exec input.")
+		influxURL            = flag.String("influx.url", "", "Send metrics in InfluxDB line protocol to this HTTP write endpoint or udp:// address instead of serving them over HTTP.")
+		influxInterval       = flag.Duration("influx.interval", 15*time.Second, "Interval at which metrics are sent to InfluxDB.")
+		influxTokenFile      = flag.String("influx.token_file", "", "File containing the token sent with every InfluxDB write request.")
+		graphiteURL          = flag.String("graphite.url", "", "Send metrics in Graphite plaintext format to this tcp:// or udp:// address instead of serving them over HTTP.")
+		graphiteInterval     = flag.Duration("graphite.interval", 15*time.Second, "Interval at which metrics are sent to Graphite.")
+		graphitePrefix       = flag.String("graphite.prefix", "", "Prefix prepended to the names of metrics in Graphite format (e.g., vpn.gw1.).")
+		rwURL                = flag.String("remote_write.url", "", "Send metrics to this Prometheus remote write endpoint instead of serving them over HTTP.")
+		rwInterval           = flag.Duration("remote_write.interval", 15*time.Second, "Interval at which metrics are collected and sent.")
+		rwExternalLabels     = flag.String("remote_write.external_labels", "", "Labels added to every series, as comma separated name=value pairs. Defaults to job=openvpn and the host name as instance.")
+		rwHeaders            = flag.String("remote_write.headers", "", "HTTP headers sent with every request, as comma separated name=value pairs (e.g., X-Scope-OrgID=tenant).")
+		rwBearerTokenFile    = flag.String("remote_write.bearer_token_file", "", "File containing the bearer token sent with every request.")
+		rwBufferDir          = flag.String("remote_write.buffer_dir", "", "Directory in which requests are buffered while the endpoint is unavailable. If empty, they are buffered in memory.")
+		rwBufferMaxBytes     = flag.Int64("remote_write.buffer_max_bytes", 64<<20, "Maximum size of the on-disk buffer, beyond which the oldest requests are dropped.")
+		rwQueueSize          = flag.Int("remote_write.queue_size", 1000, "Maximum number of requests buffered in memory, beyond which the oldest are dropped.")
+		pkiIndexPath         = flag.String("pki.index_path", "", "Path to the easy-rsa index.txt file to export certificate expiry for.")
+		pkiCAPath            = flag.String("pki.ca_path", "", "Path to the CA certificate to export expiry for.")
+		pkiServerCertPath    = flag.String("pki.server_cert_path", "", "Path to the server certificate to export expiry for.")
+		pkiCRLPath           = flag.String("pki.crl_path", "", "Path to the certificate revocation list to export update times for.")
+		ippPaths             = flag.String("ipp.paths", "", "Paths of the OpenVPN ifconfig-pool-persist files to export address pool usage for.")
+		ippPools             = flag.String("ipp.pools", "", "Address pool of each ifconfig-pool-persist file, as the --server network (e.g., 10.8.0.0/24) or an --ifconfig-pool range (e.g., 10.8.0.4-10.8.0.251).")
+		ippTopology          = flag.String("ipp.topology", "net30", "Topology of the OpenVPN servers owning the address pools (net30, p2p or subnet).")
+		ippExportClients     = flag.Bool("ipp.export_clients", false, "Export the address persisted for every common name as an info metric.")
+		logPaths             = flag.String("openvpn.log_paths", "", "Paths of OpenVPN log files to count failed TLS handshakes, authentication failures and restarts in.")
+		logPollInterval      = flag.Duration("openvpn.log_poll_interval", time.Second, "Interval at which OpenVPN log files are checked for new lines.")
+		statusPollInterval   = flag.Duration("openvpn.poll_interval", 0, "Interval at which statuses are read in the background, serving scrapes from the last read. If zero, they are read on every scrape.")
+		duplicatePolicy      = flag.String("openvpn.duplicate_policy", exporters.DuplicateFirst, "How rows of a status with the same labels are exported: with the values of the first or last of them, or their sum or maximum (first, last, sum or max).")
+		timezones            = flag.String("openvpn.timezones", "", "Time zones in which statuses print dates, as comma separated status_path=zone pairs (e.g., /run/openvpn/server.status=UTC). Defaults to the zone of the host.")
+		minRefreshIntervals  = flag.String("openvpn.min_refresh_intervals", "", "Minimum time between reads of a status, as comma separated status_path=duration pairs (e.g., /run/openvpn/server.status=30s).")
 	)
 	flag.Parse()
 
-	log.Println(version.GetVersion())
+	logger, err := logging.New(os.Stderr, *logLevel, *logFormat, *logRateLimitInterval)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	slog.SetDefault(logger)
+
+	slog.Info(version.GetVersion())
 	if *showVersion {
 		os.Exit(0)
 	}
 
 	if !isValidOpenVPNVersion(*openvpnVersion) {
-		log.Fatal("openvpn.version must be specified, currently supported versions are 2.3 and 2.4")
+		fatal("openvpn.version must be specified, currently supported versions are 2.3 and 2.4")
 	}
 
-	log.Printf("Starting OpenVPN Exporter\n")
-	log.Printf("Listen address: %v\n", *listenAddress)
-	log.Printf("Metrics path: %v\n", *metricsPath)
-	log.Printf("openvpn.status_path: %v\n", *openvpnStatusPaths)
-	log.Printf("OpenVPN Version: %v\n", *openvpnVersion)
-	log.Printf("Ignore Individuals: %v\n", *ignoreIndividuals)
+	slog.Info("Starting OpenVPN Exporter",
+		"listen_address", *listenAddress,
+		"metrics_path", *metricsPath,
+		"status_paths", *openvpnStatusPaths,
+		"openvpn_version", *openvpnVersion,
+		"ignore_individuals", *ignoreIndividuals)
 
-	exporter, err := exporters.NewOpenVPNExporter(strings.Split(*openvpnStatusPaths, ","), *ignoreIndividuals, *openvpnVersion)
-	if err != nil {
-		panic(err)
+	if !exporters.IsValidDuplicatePolicy(*duplicatePolicy) {
+		fatal("Unknown openvpn.duplicate_policy, supported policies are first, last, sum and max", "policy", *duplicatePolicy)
+	}
+	if *logPollInterval <= 0 {
+		fatal("openvpn.log_poll_interval must be positive", "interval", *logPollInterval)
+	}
+	statusOpts := statusOptions{pollInterval: *statusPollInterval, duplicatePolicy: *duplicatePolicy, ignoreRealPort: *ignoreRealPort}
+	if statusOpts.minRefreshIntervals, err = parseStatusPathPairs(*minRefreshIntervals, time.ParseDuration); err != nil {
+		fatal("Invalid openvpn.min_refresh_intervals", "err", err)
+	}
+	if statusOpts.locations, err = parseStatusPathPairs(*timezones, time.LoadLocation); err != nil {
+		fatal("Invalid openvpn.timezones", "err", err)
+	}
+
+	cfg := &config.Config{}
+	if *configFile != "" {
+		slog.Info("Loading config file", "path", *configFile)
+		if cfg, err = config.Load(*configFile); err != nil {
+			fatal("Failed to load config file", "path", *configFile, "err", err)
+		}
+	}
+
+	// Background tasks run until the process is asked to terminate, and
+	// are waited for before it exits.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	background := &backgroundTasks{ctx: ctx}
+
+	// Metrics of OpenVPN are kept apart from those of the exporter itself,
+	// so that they can be written to a textfile on their own.
+	registry := prometheus.NewRegistry()
+
+	// Status paths are only exported next to discovered instances when
+	// they have been set explicitly. They then get an empty instance
+	// label, as metrics of the same name must share label names. An empty
+	// list disables them, e.g. when only serving probes.
+	statusPathsSet := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "openvpn.status_paths" {
+			statusPathsSet = true
+		}
+	})
+	var statusSources []exporters.StatusSource
+	var statusExporters []*exporters.OpenVPNExporter
+	if (*openvpnConfigPaths == "" || statusPathsSet) && *openvpnStatusPaths != "" {
+		for _, statusPath := range strings.Split(*openvpnStatusPaths, ",") {
+			statusSources = append(statusSources, exporters.StatusSource{StatusPath: statusPath, Location: statusOpts.locations[statusPath]})
+		}
+		exporter, err := exporters.NewOpenVPNExporter(strings.Split(*openvpnStatusPaths, ","), *ignoreIndividuals, *openvpnVersion)
+		if err != nil {
+			panic(err)
+		}
+		statusOpts.apply(exporter, strings.Split(*openvpnStatusPaths, ","), background)
+		statusExporters = append(statusExporters, exporter)
+		if *openvpnConfigPaths != "" {
+			prometheus.WrapRegistererWith(prometheus.Labels{"instance": ""}, registry).MustRegister(exporter)
+		} else {
+			registry.MustRegister(exporter)
+		}
+	}
+
+	if *logPaths != "" {
+		slog.Info("Following log files", "log_paths", *logPaths)
+		logExporter, err := exporters.NewLogExporter(strings.Split(*logPaths, ","), *logPollInterval)
+		if err != nil {
+			fatal("Failed to follow log files", "err", err)
+		}
+		registry.MustRegister(logExporter)
+		background.run(logExporter.Run)
+	}
+
+	if *openvpnConfigPaths != "" {
+		slog.Info("Discovering OpenVPN instances", "config_paths", *openvpnConfigPaths)
+		instances, err := discovery.Discover(strings.Split(*openvpnConfigPaths, ","))
+		if err != nil {
+			fatal("Failed to discover OpenVPN instances", "err", err)
+		}
+		for _, instance := range instances {
+			if source, exporter := registerInstance(registry, instance, *ignoreIndividuals, *ippExportClients, *logPollInterval, statusOpts, background); exporter != nil {
+				statusSources = append(statusSources, source)
+				statusExporters = append(statusExporters, exporter)
+			}
+		}
+	}
+
+	if *pkiIndexPath != "" || *pkiCAPath != "" || *pkiServerCertPath != "" || *pkiCRLPath != "" {
+		slog.Info("Exporting PKI", "index_path", *pkiIndexPath, "ca_path", *pkiCAPath, "server_cert_path", *pkiServerCertPath, "crl_path", *pkiCRLPath)
+		pkiExporter, err := exporters.NewPKIExporter(*pkiIndexPath, *pkiCAPath, *pkiServerCertPath, *pkiCRLPath)
+		if err != nil {
+			panic(err)
+		}
+		registry.MustRegister(pkiExporter)
+	}
+
+	if *ippPaths != "" {
+		slog.Info("Exporting address pools", "ipp_paths", *ippPaths)
+		paths := strings.Split(*ippPaths, ",")
+		pools := strings.Split(*ippPools, ",")
+		if len(paths) != len(pools) {
+			fatal("ipp.pools must contain an address pool for every path in ipp.paths")
+		}
+		var sources []exporters.IPPSource
+		for i, path := range paths {
+			pool, err := exporters.ParseIPPool(pools[i], *ippTopology)
+			if err != nil {
+				fatal("Invalid address pool", "pool", pools[i], "err", err)
+			}
+			sources = append(sources, exporters.IPPSource{Path: path, Pool: pool})
+		}
+		ippExporter, err := exporters.NewIPPExporter(sources, *ippExportClients)
+		if err != nil {
+			panic(err)
+		}
+		registry.MustRegister(ippExporter)
+	}
+
+	if len(cfg.Webhooks) > 0 {
+		notifier, err := webhook.NewNotifier(statusSources, cfg.Webhooks, *webhookInterval)
+		if err != nil {
+			fatal("Failed to set up webhooks", "err", err)
+		}
+		registry.MustRegister(notifier)
+		background.run(notifier.Run)
+	}
+
+	if len(cfg.Quotas.Limits) > 0 {
+		slog.Info("Accounting quotas", "state_path", cfg.Quotas.StatePath)
+		tracker, err := quota.NewTracker(cfg.Quotas, statusSources, *quotaInterval)
+		if err != nil {
+			fatal("Failed to set up quotas", "err", err)
+		}
+		registry.MustRegister(tracker)
+		background.run(tracker.Run)
+	}
+
+	if *sessionsDBPath != "" {
+		slog.Info("Recording sessions", "db_path", *sessionsDBPath)
+		store, err := sessions.Open(*sessionsDBPath)
+		if err != nil {
+			fatal("Failed to open session database", "db_path", *sessionsDBPath, "err", err)
+		}
+		defer store.Close()
+		background.run(sessions.NewTracker(store, statusSources, *sessionsInterval).Run)
+	}
+
+	if *outputTextfile != "" {
+		slog.Info("Writing metrics to textfile", "path", *outputTextfile, "format", *outputFormat)
+		if !formats.IsValidFormat(*outputFormat) {
+			fatal("Unknown output.format, supported formats are prometheus, influx and graphite", "format", *outputFormat)
+		}
+		runTextfile(registry, *outputTextfile, *outputFormat, *graphitePrefix, *outputInterval)
+		return
+	}
+
+	if *pushFlags.url != "" {
+		slog.Info("Pushing metrics", "url", *pushFlags.url)
+		config, err := pushFlags.config()
+		if err != nil {
+			fatal("Invalid push.grouping", "err", err)
+		}
+		pusher, err := pushgateway.NewPusher(config, registry)
+		if err != nil {
+			fatal("Failed to set up push mode", "err", err)
+		}
+		runPush(ctx, pusher, *pushFlags.deleteOnShutdown, background)
+		return
+	}
+
+	if *rwURL != "" {
+		slog.Info("Sending metrics to remote write endpoint", "url", *rwURL)
+		externalLabels, err := parseLabelPairs(*rwExternalLabels)
+		if err != nil {
+			fatal("Invalid remote_write.external_labels", "err", err)
+		}
+		if _, ok := externalLabels["job"]; !ok {
+			externalLabels["job"] = "openvpn"
+		}
+		headers, err := parsePairs(*rwHeaders)
+		if err != nil {
+			fatal("Invalid remote_write.headers", "err", err)
+		}
+		client, err := remotewrite.NewClient(remotewrite.Config{
+			URL:             *rwURL,
+			Interval:        *rwInterval,
+			ExternalLabels:  externalLabels,
+			Headers:         headers,
+			BearerTokenFile: *rwBearerTokenFile,
+			BufferDir:       *rwBufferDir,
+			BufferMaxBytes:  *rwBufferMaxBytes,
+			QueueSize:       *rwQueueSize,
+			MinBackoff:      time.Second,
+			MaxBackoff:      5 * time.Minute,
+			Timeout:         30 * time.Second,
+		}, registry)
+		if err != nil {
+			fatal("Failed to set up remote write", "err", err)
+		}
+		runRemoteWrite(ctx, client, background)
+		return
+	}
+
+	if *influxURL != "" || *graphiteURL != "" {
+		config := formats.SenderConfig{
+			URL:       *influxURL,
+			Format:    formats.Influx,
+			Interval:  *influxInterval,
+			Timeout:   10 * time.Second,
+			TokenFile: *influxTokenFile,
+		}
+		if *graphiteURL != "" {
+			if *influxURL != "" {
+				fatal("influx.url and graphite.url cannot be used together")
+			}
+			config.URL = *graphiteURL
+			config.Format = formats.Graphite
+			config.Prefix = *graphitePrefix
+			config.Interval = *graphiteInterval
+		}
+		slog.Info("Sending metrics", "format", config.Format, "url", config.URL)
+		sender, err := formats.NewSender(config, registry)
+		if err != nil {
+			fatal("Failed to set up output", "format", config.Format, "err", err)
+		}
+		runSender(ctx, sender, background)
+		return
 	}
-	prometheus.MustRegister(exporter)
 
-	http.Handle(*metricsPath, promhttp.Handler())
+	if len(cfg.Probe.Modules) > 0 {
+		probeHandler, err := probe.NewHandler(cfg.Probe)
+		if err != nil {
+			fatal("Failed to set up probes", "err", err)
+		}
+		http.Handle("/probe", probeHandler)
+	}
+	http.HandleFunc("/-/healthy", healthy)
+	http.Handle("/-/ready", newReadiness(statusExporters))
+	http.Handle("/influx", formats.Handler(registry, formats.Influx, ""))
+	http.Handle("/graphite", formats.Handler(registry, formats.Graphite, *graphitePrefix))
+	http.Handle(*metricsPath, promhttp.InstrumentMetricHandler(
+		prometheus.DefaultRegisterer,
+		promhttp.HandlerFor(prometheus.Gatherers{prometheus.DefaultGatherer, registry}, promhttp.HandlerOpts{}),
+	))
 	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		_, err := w.Write([]byte(`
 			<html>
@@ -67,13 +373,154 @@ func main() {
 			<body>
 			<h1>OpenVPN Exporter</h1>
 			<p><a href='` + *metricsPath + `'>Metrics</a></p>
+			<p><a href='/influx'>Metrics in InfluxDB line protocol</a></p>
+			<p><a href='/graphite'>Metrics in Graphite plaintext format</a></p>
 			</body>
 			</html>`))
 		if err != nil {
-			log.Printf("Error writing HTML: %v", err)
+			slog.Debug("Failed to write landing page", "err", err)
 		}
 	})
-	log.Fatal(http.ListenAndServe(*listenAddress, nil))
+	runServer(ctx, *listenAddress, *shutdownTimeout, background)
+}
+
+// Registers the exporters for an OpenVPN instance found through discovery,
+// labelling all of their metrics with the instance name. Returns the path
+// from which the status of the instance is read and its exporter, if any.
+func registerInstance(registry prometheus.Registerer, instance discovery.Instance, ignoreIndividuals bool, ippExportClients bool, logPollInterval time.Duration, statusOpts statusOptions, background *backgroundTasks) (exporters.StatusSource, *exporters.OpenVPNExporter) {
+	registerer := prometheus.WrapRegistererWith(prometheus.Labels{"instance": instance.Name}, registry)
+
+	// The status file is preferred, as reading it does not interfere with
+	// other users of the management interface.
+	statusPath, version, passwordFile := instance.StatusPath, instance.OpenVPNVersion(), ""
+	if statusPath == "" {
+		// The management interface is read with status 3, regardless of
+		// the status-version of the status file. Its password file is
+		// kept out of the status path, which ends up in labels.
+		statusPath, version, passwordFile = instance.Management, "2.3", instance.ManagementPasswordFile
+	}
+	source := exporters.StatusSource{Instance: instance.Name, StatusPath: statusPath, Location: statusOpts.locations[statusPath], PasswordFile: passwordFile}
+	var exporter *exporters.OpenVPNExporter
+	if statusPath == "" {
+		slog.Warn("Instance has neither a status file nor a management interface", "instance", instance.Name, "config_path", instance.ConfigPath)
+	} else {
+		slog.Info("Discovered status", "instance", instance.Name, "status_path", statusPath)
+		var err error
+		exporter, err = exporters.NewOpenVPNExporter([]string{statusPath}, ignoreIndividuals, version)
+		if err != nil {
+			panic(err)
+		}
+		statusOpts.apply(exporter, []string{statusPath}, background)
+		if passwordFile != "" {
+			exporter.SetPasswordFile(statusPath, passwordFile)
+		}
+		registerer.MustRegister(exporter)
+	}
+
+	if instance.LogPath != "" {
+		slog.Info("Discovered log file", "instance", instance.Name, "log_path", instance.LogPath)
+		logExporter, err := exporters.NewLogExporter([]string{instance.LogPath}, logPollInterval)
+		if err != nil {
+			panic(err)
+		}
+		registerer.MustRegister(logExporter)
+		background.run(logExporter.Run)
+	}
+
+	if instance.IfconfigPoolPersist != "" && instance.Server.IsValid() {
+		pool, err := exporters.NewIPPoolFromServer(instance.Server, instance.Topology)
+		if err != nil {
+			slog.Warn("Cannot determine address pool", "instance", instance.Name, "err", err)
+			return source, exporter
+		}
+		slog.Info("Discovered ifconfig-pool-persist file", "instance", instance.Name, "path", instance.IfconfigPoolPersist)
+		ippExporter, err := exporters.NewIPPExporter([]exporters.IPPSource{{Path: instance.IfconfigPoolPersist, Pool: pool}}, ippExportClients)
+		if err != nil {
+			panic(err)
+		}
+		registerer.MustRegister(ippExporter)
+	}
+	return source, exporter
+}
+
+// How the statuses of OpenVPN are read and exported, shared by the
+// exporters of the status paths and of discovered instances.
+type statusOptions struct {
+	pollInterval        time.Duration
+	minRefreshIntervals map[string]time.Duration
+	locations           map[string]*time.Location
+	duplicatePolicy     string
+	ignoreRealPort      bool
+}
+
+// Applies the options to an exporter, starting to poll its status paths
+// in the background if enabled.
+func (o statusOptions) apply(exporter *exporters.OpenVPNExporter, statusPaths []string, background *backgroundTasks) {
+	if err := exporter.SetDuplicatePolicy(o.duplicatePolicy); err != nil {
+		panic(err)
+	}
+	exporter.SetIgnoreRealPort(o.ignoreRealPort)
+	for _, statusPath := range statusPaths {
+		if interval, ok := o.minRefreshIntervals[statusPath]; ok {
+			exporter.SetMinRefreshInterval(statusPath, interval)
+		}
+		if location, ok := o.locations[statusPath]; ok {
+			exporter.SetLocation(statusPath, location)
+		}
+	}
+	if o.pollInterval > 0 {
+		background.run(func(ctx context.Context) { exporter.Run(ctx, o.pollInterval) })
+	}
+}
+
+// Goroutines that run until the process is asked to terminate, which
+// cancels their context, and that are waited for before it exits, e.g.
+// so that state is not written while exiting.
+type backgroundTasks struct {
+	ctx context.Context
+	wg  sync.WaitGroup
+}
+
+func (b *backgroundTasks) run(task func(ctx context.Context)) {
+	b.wg.Add(1)
+	go func() {
+		defer b.wg.Done()
+		task(b.ctx)
+	}()
+}
+
+// Waits for all tasks to return once the context has been cancelled.
+func (b *backgroundTasks) wait() {
+	<-b.ctx.Done()
+	b.wg.Wait()
+}
+
+// Parses comma separated status_path=value pairs, passing every value to
+// the given function. Status paths of management interfaces may contain
+// an equals sign themselves, so pairs are split at the last one.
+func parseStatusPathPairs[T any](value string, parse func(string) (T, error)) (map[string]T, error) {
+	pairs := map[string]T{}
+	if value == "" {
+		return pairs, nil
+	}
+	for _, pair := range strings.Split(value, ",") {
+		i := strings.LastIndex(pair, "=")
+		if i <= 0 {
+			return nil, fmt.Errorf("expected status_path=value, got %q", pair)
+		}
+		parsed, err := parse(pair[i+1:])
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for %s: %s", pair[:i], err)
+		}
+		pairs[pair[:i]] = parsed
+	}
+	return pairs, nil
+}
+
+// Logs an error and exits, as slog has no equivalent of log.Fatal.
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
 }
 
 func isValidOpenVPNVersion(version string) bool {
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/kumina/openvpn_exporter/pkg/pushgateway"
+)
+
+// Parses comma separated name=value pairs.
+func parsePairs(value string) (map[string]string, error) {
+	pairs := map[string]string{}
+	if value == "" {
+		return pairs, nil
+	}
+	for _, pair := range strings.Split(value, ",") {
+		name, pairValue, ok := strings.Cut(pair, "=")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("expected name=value, got %q", pair)
+		}
+		pairs[name] = pairValue
+	}
+	return pairs, nil
+}
+
+// Parses labels given as comma separated name=value pairs, as used for
+// Pushgateway grouping keys and remote write external labels. Unless set
+// explicitly, the instance is the host name, matching what Prometheus
+// would use when scraping the exporter.
+func parseLabelPairs(value string) (map[string]string, error) {
+	labels, err := parsePairs(value)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := labels["instance"]; !ok {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return nil, err
+		}
+		labels["instance"] = hostname
+	}
+	return labels, nil
+}
+
+// Flags of push mode.
+type pushFlags struct {
+	url              *string
+	job              *string
+	interval         *time.Duration
+	groupingLabels   *string
+	grouping         *string
+	retries          *int
+	deleteOnShutdown *bool
+}
+
+func registerPushFlags(flags *flag.FlagSet) *pushFlags {
+	return &pushFlags{
+		url:              flags.String("push.url", "", "Push metrics to the Pushgateway at this URL instead of serving them over HTTP."),
+		job:              flags.String("push.job", "openvpn", "Job name under which metrics are pushed."),
+		interval:         flags.Duration("push.interval", 30*time.Second, "Interval at which metrics are pushed."),
+		groupingLabels:   flags.String("push.grouping_labels", "instance", "Labels whose values split metrics into separate Pushgateway groups."),
+		grouping:         flags.String("push.grouping", "", "Additional grouping key for pushed metrics, as comma separated name=value pairs. Defaults to the host name as instance."),
+		retries:          flags.Int("push.retries", 3, "Number of times a failed push is retried before waiting for the next interval."),
+		deleteOnShutdown: flags.Bool("push.delete_on_shutdown", false, "Delete pushed metrics from the Pushgateway on shutdown."),
+	}
+}
+
+// Returns the Pushgateway configuration given by the flags. Unless set
+// explicitly, the instance is the host name. Pairs of the grouping key
+// naming a grouping label, such as the default instance, are only used
+// for metrics lacking that label, as the Pushgateway cannot group by a
+// label that is also a fixed grouping key.
+func (f *pushFlags) config() (pushgateway.Config, error) {
+	grouping, err := parseLabelPairs(*f.grouping)
+	if err != nil {
+		return pushgateway.Config{}, err
+	}
+	var groupingLabels []string
+	if *f.groupingLabels != "" {
+		groupingLabels = strings.Split(*f.groupingLabels, ",")
+	}
+	defaultGrouping := map[string]string{}
+	for name, value := range grouping {
+		if slices.Contains(groupingLabels, name) {
+			defaultGrouping[name] = value
+			delete(grouping, name)
+		}
+	}
+	return pushgateway.Config{
+		URL:             *f.url,
+		Job:             *f.job,
+		Interval:        *f.interval,
+		Retries:         *f.retries,
+		GroupingLabels:  groupingLabels,
+		Grouping:        grouping,
+		DefaultGrouping: defaultGrouping,
+	}, nil
+}
+
+// Pushes metrics until the context is cancelled, when the process is asked
+// to terminate, and waits for the background tasks, optionally deleting the
+// metrics from the Pushgateway afterwards.
+func runPush(ctx context.Context, pusher *pushgateway.Pusher, deleteOnShutdown bool, background *backgroundTasks) {
+	pusher.Run(ctx)
+	background.wait()
+
+	if deleteOnShutdown {
+		slog.Info("Deleting pushed metrics")
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if err := pusher.Delete(ctx); err != nil {
+			slog.Error("Failed to delete pushed metrics", "err", err)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/kumina/openvpn_exporter/pkg/pushgateway"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Pushgateway recording the grouping keys metrics are pushed to, as sorted
+// name=value pairs, as the order of labels in the path is not fixed.
+type fakePushgateway struct {
+	mu        sync.Mutex
+	groupings []string
+}
+
+func (g *fakePushgateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/metrics/"), "/")
+	var pairs []string
+	for i := 0; i+1 < len(parts); i += 2 {
+		pairs = append(pairs, parts[i]+"="+parts[i+1])
+	}
+	slices.Sort(pairs)
+	g.groupings = append(g.groupings, strings.Join(pairs, ","))
+	w.WriteHeader(http.StatusOK)
+}
+
+func TestPushFlags(t *testing.T) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		t.Fatal(err)
+	}
+	registry := prometheus.NewRegistry()
+	up := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "openvpn_up"}, []string{"instance"})
+	up.WithLabelValues("tun0").Set(1)
+	up.WithLabelValues("").Set(1)
+	registry.MustRegister(up)
+
+	tests := []struct {
+		args     []string
+		expected []string
+	}{
+		{
+			nil,
+			[]string{"instance=" + hostname + ",job=openvpn", "instance=tun0,job=openvpn"},
+		},
+		{
+			[]string{"-push.grouping", "site=ams"},
+			[]string{"instance=" + hostname + ",job=openvpn,site=ams", "instance=tun0,job=openvpn,site=ams"},
+		},
+		{
+			[]string{"-push.grouping", "instance=gw1"},
+			[]string{"instance=gw1,job=openvpn", "instance=tun0,job=openvpn"},
+		},
+	}
+	for _, test := range tests {
+		gateway := &fakePushgateway{}
+		server := httptest.NewServer(gateway)
+		flags := flag.NewFlagSet("openvpn_exporter", flag.ContinueOnError)
+		pushFlags := registerPushFlags(flags)
+		if err := flags.Parse(append([]string{"-push.url", server.URL}, test.args...)); err != nil {
+			t.Fatal(err)
+		}
+		config, err := pushFlags.config()
+		if err != nil {
+			t.Fatalf("%q: %s", test.args, err)
+		}
+		pusher, err := pushgateway.NewPusher(config, registry)
+		if err != nil {
+			t.Fatalf("%q: %s", test.args, err)
+		}
+		if err := pusher.Push(context.Background()); err != nil {
+			t.Fatalf("%q: %s", test.args, err)
+		}
+		server.Close()
+		slices.Sort(gateway.groupings)
+		slices.Sort(test.expected)
+		if !slices.Equal(gateway.groupings, test.expected) {
+			t.Errorf("%q: expected pushes to %v, got %v", test.args, test.expected, gateway.groupings)
+		}
+	}
+}
@@ -0,0 +1,14 @@
+package main
+
+import (
+	"context"
+
+	"github.com/kumina/openvpn_exporter/pkg/remotewrite"
+)
+
+// Sends metrics until the context is cancelled, when the process is asked
+// to terminate, and waits for the background tasks.
+func runRemoteWrite(ctx context.Context, client *remotewrite.Client, background *backgroundTasks) {
+	client.Run(ctx)
+	background.wait()
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/kumina/openvpn_exporter/pkg/sessions"
+)
+
+// Parses a time given as a date, interpreted in local time, or in RFC
+// 3339 format.
+func parseReportTime(value string) (time.Time, error) {
+	if t, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+type reportRow struct {
+	CommonName      string  `json:"common_name"`
+	Username        string  `json:"username"`
+	Sessions        int     `json:"sessions"`
+	DurationSeconds int64   `json:"duration_seconds"`
+	Hours           float64 `json:"hours"`
+	BytesReceived   int64   `json:"bytes_received"`
+	BytesSent       int64   `json:"bytes_sent"`
+}
+
+func writeReport(out io.Writer, format string, usages []sessions.Usage) error {
+	rows := []reportRow{}
+	for _, usage := range usages {
+		rows = append(rows, reportRow{
+			CommonName:      usage.CommonName,
+			Username:        usage.Username,
+			Sessions:        usage.Sessions,
+			DurationSeconds: int64(usage.Duration.Seconds()),
+			Hours:           usage.Duration.Hours(),
+			BytesReceived:   usage.BytesReceived,
+			BytesSent:       usage.BytesSent,
+		})
+	}
+	switch format {
+	case "json":
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(rows)
+	case "csv":
+		writer := csv.NewWriter(out)
+		writer.Write([]string{"common_name", "username", "sessions", "duration_seconds", "hours", "bytes_received", "bytes_sent"})
+		for _, row := range rows {
+			writer.Write([]string{
+				row.CommonName,
+				row.Username,
+				strconv.Itoa(row.Sessions),
+				strconv.FormatInt(row.DurationSeconds, 10),
+				strconv.FormatFloat(row.Hours, 'f', 2, 64),
+				strconv.FormatInt(row.BytesReceived, 10),
+				strconv.FormatInt(row.BytesSent, 10),
+			})
+		}
+		writer.Flush()
+		return writer.Error()
+	}
+	return fmt.Errorf("unknown format %q, supported formats are csv and json", format)
+}
+
+// Implements the report command, which aggregates the sessions recorded
+// in the session store per user.
+func runReport(args []string) {
+	now := time.Now()
+	flags := flag.NewFlagSet("report", flag.ExitOnError)
+	var (
+		dbPath = flags.String("sessions.db_path", "openvpn_sessions.db", "Path to the session database.")
+		from   = flags.String("from", now.AddDate(0, 0, 1-now.Day()).Format("2006-01-02"), "Start of the period, as a date or in RFC 3339 format. Defaults to the start of the current month.")
+		to     = flags.String("to", "", "End of the period, exclusive, as a date or in RFC 3339 format. Defaults to now.")
+		format = flags.String("format", "csv", "Output format (csv or json).")
+	)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s report [flags]\n\nAggregates the traffic and connection time of every user over a period.\nSessions are attributed to the period in which they started.\nSessions of a server that cannot be read are ended three poll intervals\nafter they were last seen.\n\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	fromTime, err := parseReportTime(*from)
+	if err != nil {
+		fatal("Invalid from time", "from", *from, "err", err)
+	}
+	toTime := now
+	if *to != "" {
+		if toTime, err = parseReportTime(*to); err != nil {
+			fatal("Invalid to time", "to", *to, "err", err)
+		}
+	}
+	store, err := sessions.OpenReadOnly(*dbPath)
+	if err != nil {
+		fatal("Failed to open session database", "db_path", *dbPath, "err", err)
+	}
+	defer store.Close()
+	usages, err := store.Report(fromTime, toTime)
+	if err != nil {
+		fatal("Failed to aggregate sessions", "err", err)
+	}
+	if err := writeReport(os.Stdout, *format, usages); err != nil {
+		fatal("Failed to write report", "err", err)
+	}
+}
@@ -0,0 +1,14 @@
+package main
+
+import (
+	"context"
+
+	"github.com/kumina/openvpn_exporter/pkg/formats"
+)
+
+// Sends metrics until the context is cancelled, when the process is asked
+// to terminate, and waits for the background tasks.
+func runSender(ctx context.Context, sender *formats.Sender, background *backgroundTasks) {
+	sender.Run(ctx)
+	background.wait()
+}
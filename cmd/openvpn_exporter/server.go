@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/kumina/openvpn_exporter/pkg/exporters"
+	"github.com/kumina/openvpn_exporter/pkg/sdnotify"
+)
+
+// Tracks whether every status source has been read successfully at least
+// once, as recorded by the exporters. Sources that have not are read in
+// the background when readiness is queried, so the exporter becomes ready
+// without waiting for the first scrape.
+type readiness struct {
+	exporters []*exporters.OpenVPNExporter
+	reading   atomic.Bool
+}
+
+func newReadiness(exporters []*exporters.OpenVPNExporter) *readiness {
+	return &readiness{exporters: exporters}
+}
+
+func (r *readiness) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	var pending []string
+	for _, exporter := range r.exporters {
+		pending = append(pending, exporter.Pending()...)
+	}
+	if len(pending) > 0 {
+		if r.reading.CompareAndSwap(false, true) {
+			go func() {
+				defer r.reading.Store(false)
+				for _, exporter := range r.exporters {
+					exporter.ReadPending()
+				}
+			}()
+		}
+		http.Error(w, fmt.Sprintf("OpenVPN Exporter is not ready, waiting for %s.", strings.Join(pending, ", ")), http.StatusServiceUnavailable)
+		return
+	}
+	fmt.Fprintf(w, "OpenVPN Exporter is Ready.\n")
+}
+
+func healthy(w http.ResponseWriter, _ *http.Request) {
+	fmt.Fprintf(w, "OpenVPN Exporter is Healthy.\n")
+}
+
+// Serves HTTP requests until the context is cancelled, when the process
+// receives SIGINT or SIGTERM, and then waits for the background tasks to
+// return and for in-flight requests to complete for at most the shutdown
+// timeout. When run by systemd as a Type=notify service, readiness is
+// reported once the listener is bound, and the watchdog is kept happy
+// for as long as the server runs.
+func runServer(ctx context.Context, listenAddress string, shutdownTimeout time.Duration, background *backgroundTasks) {
+	listener, err := net.Listen("tcp", listenAddress)
+	if err != nil {
+		fatal("Failed to serve HTTP requests", "listen_address", listenAddress, "err", err)
+	}
+
+	server := &http.Server{}
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- server.Serve(listener)
+	}()
+
+	if _, err := sdnotify.Notify("READY=1"); err != nil {
+		slog.Warn("Failed to notify systemd of readiness", "err", err)
+	}
+	if interval := sdnotify.WatchdogInterval(); interval > 0 {
+		go func() {
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+					if _, err := sdnotify.Notify("WATCHDOG=1"); err != nil {
+						slog.Warn("Failed to notify systemd watchdog", "err", err)
+					}
+				}
+			}
+		}()
+	}
+
+	select {
+	case err := <-serveErr:
+		fatal("Failed to serve HTTP requests", "listen_address", listenAddress, "err", err)
+	case <-ctx.Done():
+	}
+	slog.Info("Shutting down, waiting for background tasks and in-flight requests to complete")
+	background.wait()
+	_, _ = sdnotify.Notify("STOPPING=1")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		slog.Warn("Failed to shut down gracefully", "err", err)
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/kumina/openvpn_exporter/pkg/formats"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Writes the gathered metrics in the given format to a file, or to
+// standard output if the path is "-", as expected by Telegraf's exec
+// input. Files are replaced atomically, so readers never see a partial
+// file.
+func writeTextfile(gatherer prometheus.Gatherer, path string, format string, prefix string) error {
+	if format == formats.Prometheus && path != "-" {
+		return prometheus.WriteToTextfile(path, gatherer)
+	}
+	families, err := gatherer.Gather()
+	if err != nil && len(families) == 0 {
+		return err
+	}
+	var body bytes.Buffer
+	if err := formats.Encode(&body, format, families, prefix, time.Now()); err != nil {
+		return err
+	}
+	if path == "-" {
+		_, err := os.Stdout.Write(body.Bytes())
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(body.Bytes()); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		return fmt.Errorf("failed to set permissions: %s", err)
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Writes the gathered metrics to a file for node_exporter's textfile
+// collector, or another consumer, once or, if an interval is given,
+// repeatedly.
+func runTextfile(gatherer prometheus.Gatherer, path string, format string, prefix string, interval time.Duration) {
+	for {
+		if err := writeTextfile(gatherer, path, format, prefix); err != nil {
+			if interval == 0 {
+				fatal("Failed to write textfile", "path", path, "err", err)
+			}
+			slog.Warn("Failed to write textfile", "path", path, "err", err)
+		}
+		if interval == 0 {
+			return
+		}
+		time.Sleep(interval)
+	}
+}
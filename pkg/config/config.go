@@ -0,0 +1,134 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Settings that do not fit into command line flags, read from the file
+// given with --config.file.
+type Config struct {
+	Webhooks []WebhookConfig `yaml:"webhooks"`
+	Quotas   QuotasConfig    `yaml:"quotas"`
+	Probe    ProbeConfig     `yaml:"probe"`
+}
+
+// Webhook notified when clients connect to or disconnect from a server.
+type WebhookConfig struct {
+	Name string `yaml:"name"`
+	URL  string `yaml:"url"`
+	// Events to notify about, connect and/or disconnect. Defaults to both.
+	Events []string `yaml:"events"`
+	// Regular expressions, of which a client's common name must match at
+	// least one. If empty, all clients match.
+	CommonNames []string `yaml:"common_names"`
+	// Go template rendering the request body. If empty, the event is sent
+	// as JSON.
+	Template string `yaml:"template"`
+	// Defaults to application/json.
+	ContentType string            `yaml:"content_type"`
+	Headers     map[string]string `yaml:"headers"`
+	// File containing the secret with which request bodies are signed.
+	SecretFile string `yaml:"secret_file"`
+	// Number of times a failed request is retried. Defaults to 3.
+	Retries *int `yaml:"retries"`
+	// Defaults to 10s.
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+// Traffic quotas of users, accounted over recurring periods.
+type QuotasConfig struct {
+	// File in which the traffic used in the current periods is kept
+	// across restarts.
+	StatePath string        `yaml:"state_path"`
+	Limits    []QuotaConfig `yaml:"limits"`
+}
+
+// Quota of a single user, identified by either common name or username.
+type QuotaConfig struct {
+	CommonName string `yaml:"common_name"`
+	Username   string `yaml:"username"`
+	// Traffic allowed per period, counting both directions, in bytes or
+	// with a unit such as GB or GiB.
+	Limit string `yaml:"limit"`
+	// Length of the period, daily, weekly or monthly. Defaults to
+	// monthly.
+	Period string `yaml:"period"`
+	// Day on which weekly periods (0 for Sunday to 6) and monthly
+	// periods (1 to 28) start. Defaults to Sunday and the first.
+	ResetDay int `yaml:"reset_day"`
+}
+
+// Settings of the /probe endpoint, which reads the status of the target
+// given in the request.
+type ProbeConfig struct {
+	// Regular expressions, of which a target must fully match at least
+	// one to be probed. Without any, all targets are rejected.
+	AllowedTargets []string                `yaml:"allowed_targets"`
+	Modules        map[string]ModuleConfig `yaml:"modules"`
+}
+
+// Named settings with which targets are probed.
+type ModuleConfig struct {
+	// Status file format of the target, as with --openvpn.version.
+	// Defaults to 2.3.
+	Version           string `yaml:"version"`
+	IgnoreIndividuals bool   `yaml:"ignore_individuals"`
+	IgnoreRealPort    bool   `yaml:"ignore_real_port"`
+	// File containing the password of management interface targets.
+	PasswordFile string `yaml:"password_file"`
+	// Time zone in which the target prints dates, such as UTC or
+	// Europe/Amsterdam. Defaults to the zone of the host.
+	Timezone string `yaml:"timezone"`
+}
+
+// Reads a configuration file, rejecting unknown fields so that typos do
+// not go unnoticed.
+func Load(path string) (*Config, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	decoder.KnownFields(true)
+	config := &Config{}
+	if err := decoder.Decode(config); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("failed to parse %s: %s", path, err)
+	}
+	names := map[string]bool{}
+	for i, webhook := range config.Webhooks {
+		if webhook.Name == "" {
+			return nil, fmt.Errorf("webhook %d has no name", i)
+		}
+		if names[webhook.Name] {
+			return nil, fmt.Errorf("webhook %s is defined more than once", webhook.Name)
+		}
+		names[webhook.Name] = true
+		if webhook.URL == "" {
+			return nil, fmt.Errorf("webhook %s has no url", webhook.Name)
+		}
+	}
+	for i, quota := range config.Quotas.Limits {
+		if (quota.CommonName == "") == (quota.Username == "") {
+			return nil, fmt.Errorf("quota %d must have either a common_name or a username", i)
+		}
+	}
+	if len(config.Quotas.Limits) > 0 && config.Quotas.StatePath == "" {
+		return nil, fmt.Errorf("quotas require a state_path")
+	}
+	for name, module := range config.Probe.Modules {
+		if module.Version != "" && module.Version != "2.3" && module.Version != "2.4" {
+			return nil, fmt.Errorf("module %s: unsupported version %q", name, module.Version)
+		}
+		if _, err := time.LoadLocation(module.Timezone); err != nil {
+			return nil, fmt.Errorf("module %s: %s", name, err)
+		}
+	}
+	return config, nil
+}
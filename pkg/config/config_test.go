@@ -0,0 +1,36 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yml")
+	for _, test := range []struct {
+		content string
+		err     string
+	}{
+		{content: ""},
+		{content: "webhooks:\n  - name: slack\n    url: https://hooks.example.com/x\n    retries: 0\n"},
+		{content: "webhooks:\n  - name: slack\n    url: https://hooks.example.com/x\n    retry: 1\n", err: "field retry not found"},
+		{content: "webhooks:\n  - url: https://hooks.example.com/x\n", err: "has no name"},
+		{content: "webhooks:\n  - name: slack\n", err: "has no url"},
+		{content: "quotas:\n  state_path: /tmp/q.json\n  limits:\n    - common_name: alice\n      username: alice\n      limit: 1GB\n", err: "either a common_name or a username"},
+		{content: "quotas:\n  limits:\n    - common_name: alice\n      limit: 1GB\n", err: "require a state_path"},
+		{content: "probe:\n  modules:\n    default:\n      timezone: Europe/Amsterdam\n"},
+		{content: "probe:\n  modules:\n    default:\n      timezone: Mars/Olympus\n", err: "module default: unknown time zone"},
+	} {
+		if err := os.WriteFile(path, []byte(test.content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		_, err := Load(path)
+		if test.err == "" && err != nil {
+			t.Errorf("%q: unexpected error: %s", test.content, err)
+		} else if test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)) {
+			t.Errorf("%q: expected error containing %q, got %v", test.content, test.err, err)
+		}
+	}
+}
@@ -0,0 +1,225 @@
+package discovery
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// OpenVPN instance described by a configuration file, with all paths made
+// absolute.
+type Instance struct {
+	Name                   string
+	ConfigPath             string
+	StatusPath             string
+	StatusVersion          int
+	Management             string
+	ManagementPasswordFile string
+	IfconfigPoolPersist    string
+	LogPath                string
+	Server                 netip.Prefix
+	Topology               string
+}
+
+// Returns the exporter's openvpn.version equivalent for the configured
+// status file format. Format version 1 is what the exporter parses as 2.4,
+// while versions 2 and 3 are parsed as 2.3.
+func (i Instance) OpenVPNVersion() string {
+	if i.StatusVersion == 1 {
+		return "2.4"
+	}
+	return "2.3"
+}
+
+// Splits a configuration line into its directive and arguments, honouring
+// OpenVPN's quoting and comment rules.
+func splitConfigLine(line string) ([]string, error) {
+	var fields []string
+	var field strings.Builder
+	inField := false
+	var quote rune
+	escaped := false
+	for _, c := range line {
+		switch {
+		case escaped:
+			field.WriteRune(c)
+			escaped = false
+		case c == '\\' && quote != '\'':
+			escaped = true
+			inField = true
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			} else {
+				field.WriteRune(c)
+			}
+		case c == '"' || c == '\'':
+			quote = c
+			inField = true
+		case c == '#' || c == ';':
+			if !inField {
+				return fields, nil
+			}
+			field.WriteRune(c)
+		case c == ' ' || c == '\t' || c == '\r':
+			if inField {
+				fields = append(fields, field.String())
+				field.Reset()
+				inField = false
+			}
+		default:
+			field.WriteRune(c)
+			inField = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated quote")
+	}
+	if inField {
+		fields = append(fields, field.String())
+	}
+	return fields, nil
+}
+
+// Parses an OpenVPN configuration file, only retaining the directives that
+// are relevant to the exporter. Relative paths are resolved against the
+// directory set by the cd directive or, lacking that, the directory
+// containing the configuration file.
+func ParseConfig(name string, configPath string, file io.Reader) (Instance, error) {
+	instance := Instance{
+		Name:          name,
+		ConfigPath:    configPath,
+		StatusVersion: 1,
+		Topology:      "net30",
+	}
+	baseDir := filepath.Dir(configPath)
+	var relativePaths []*string
+	scanner := bufio.NewScanner(file)
+	scanner.Split(bufio.ScanLines)
+	lineNumber := 0
+	inlineTag := ""
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if inlineTag != "" {
+			// Skip inline files such as <ca> and <tls-auth>.
+			if line == "</"+inlineTag+">" {
+				inlineTag = ""
+			}
+			continue
+		}
+		if strings.HasPrefix(line, "<") && strings.HasSuffix(line, ">") && !strings.HasPrefix(line, "</") {
+			inlineTag = line[1 : len(line)-1]
+			continue
+		}
+		fields, err := splitConfigLine(line)
+		if err != nil {
+			return Instance{}, fmt.Errorf("%s:%d: %s", configPath, lineNumber, err)
+		}
+		if len(fields) == 0 {
+			continue
+		}
+		directive, args := strings.TrimPrefix(fields[0], "--"), fields[1:]
+		switch {
+		case directive == "cd" && len(args) >= 1:
+			baseDir = args[0]
+		case directive == "status" && len(args) >= 1:
+			instance.StatusPath = args[0]
+			relativePaths = append(relativePaths, &instance.StatusPath)
+		case directive == "status-version" && len(args) >= 1:
+			instance.StatusVersion, err = strconv.Atoi(args[0])
+			if err != nil || instance.StatusVersion < 1 || instance.StatusVersion > 3 {
+				return Instance{}, fmt.Errorf("%s:%d: invalid status-version %q", configPath, lineNumber, args[0])
+			}
+		case directive == "management" && len(args) >= 2:
+			if args[1] == "unix" {
+				instance.Management = args[0]
+				relativePaths = append(relativePaths, &instance.Management)
+			} else {
+				instance.Management = net.JoinHostPort(args[0], args[1])
+			}
+			if len(args) >= 3 && args[2] != "stdin" {
+				instance.ManagementPasswordFile = args[2]
+				relativePaths = append(relativePaths, &instance.ManagementPasswordFile)
+			}
+		case directive == "ifconfig-pool-persist" && len(args) >= 1:
+			instance.IfconfigPoolPersist = args[0]
+			relativePaths = append(relativePaths, &instance.IfconfigPoolPersist)
+		case (directive == "log" || directive == "log-append") && len(args) >= 1:
+			instance.LogPath = args[0]
+			relativePaths = append(relativePaths, &instance.LogPath)
+		case directive == "server" && len(args) >= 2:
+			network, err := netip.ParseAddr(args[0])
+			if err != nil {
+				return Instance{}, fmt.Errorf("%s:%d: invalid server network: %s", configPath, lineNumber, err)
+			}
+			netmask, err := netip.ParseAddr(args[1])
+			if err != nil || !netmask.Is4() {
+				return Instance{}, fmt.Errorf("%s:%d: invalid server netmask %q", configPath, lineNumber, args[1])
+			}
+			mask := netmask.As4()
+			bits, _ := net.IPv4Mask(mask[0], mask[1], mask[2], mask[3]).Size()
+			instance.Server = netip.PrefixFrom(network, bits).Masked()
+		case directive == "topology" && len(args) >= 1:
+			instance.Topology = args[0]
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return Instance{}, err
+	}
+
+	for _, path := range relativePaths {
+		if !filepath.IsAbs(*path) {
+			*path = filepath.Join(baseDir, *path)
+		}
+	}
+	if instance.Management != "" {
+		if filepath.IsAbs(instance.Management) {
+			instance.Management = "unix://" + instance.Management
+		} else {
+			instance.Management = "tcp://" + instance.Management
+		}
+	}
+	return instance, nil
+}
+
+// Finds all OpenVPN instances whose configuration files match the given
+// glob patterns. Instances are named after their configuration file,
+// without the .conf or .ovpn extension.
+func Discover(patterns []string) ([]Instance, error) {
+	var instances []Instance
+	names := map[string]string{}
+	for _, pattern := range patterns {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid config path pattern %q: %s", pattern, err)
+		}
+		sort.Strings(matches)
+		for _, configPath := range matches {
+			name := strings.TrimSuffix(strings.TrimSuffix(filepath.Base(configPath), ".conf"), ".ovpn")
+			if other, ok := names[name]; ok {
+				return nil, fmt.Errorf("config files %s and %s share the instance name %q", other, configPath, name)
+			}
+			names[name] = configPath
+
+			file, err := os.Open(configPath)
+			if err != nil {
+				return nil, err
+			}
+			instance, err := ParseConfig(name, configPath, file)
+			file.Close()
+			if err != nil {
+				return nil, err
+			}
+			instances = append(instances, instance)
+		}
+	}
+	return instances, nil
+}
@@ -0,0 +1,85 @@
+package discovery
+
+import (
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseConfig(t *testing.T) {
+	config := `# Sample server
+port 1194
+server 10.8.0.0 255.255.255.0 ; pool
+topology subnet
+ifconfig-pool-persist ipp.txt 60
+status "/var/log/openvpn/server status.log" 30
+status-version 2
+management 127.0.0.1 7505 /etc/openvpn/management.pw
+log-append /var/log/openvpn/server.log
+<ca>
+-----BEGIN CERTIFICATE-----
+status /ignored
+-----END CERTIFICATE-----
+</ca>
+`
+	instance, err := ParseConfig("server", "/etc/openvpn/server/server.conf", strings.NewReader(config))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := Instance{
+		Name:                   "server",
+		ConfigPath:             "/etc/openvpn/server/server.conf",
+		StatusPath:             "/var/log/openvpn/server status.log",
+		StatusVersion:          2,
+		Management:             "tcp://127.0.0.1:7505",
+		ManagementPasswordFile: "/etc/openvpn/management.pw",
+		IfconfigPoolPersist:    "/etc/openvpn/server/ipp.txt",
+		LogPath:                "/var/log/openvpn/server.log",
+		Server:                 netip.MustParsePrefix("10.8.0.0/24"),
+		Topology:               "subnet",
+	}
+	if instance != expected {
+		t.Errorf("expected %+v, got %+v", expected, instance)
+	}
+	if instance.OpenVPNVersion() != "2.3" {
+		t.Errorf("expected status-version 2 to be parsed as 2.3, got %s", instance.OpenVPNVersion())
+	}
+
+	for _, config := range []string{
+		"status-version 4\n",
+		"server 10.8.0.0 255.255.255\n",
+		"status \"/var/log/openvpn.status\n",
+	} {
+		if _, err := ParseConfig("server", "server.conf", strings.NewReader(config)); err == nil {
+			t.Errorf("expected error for %q", config)
+		}
+	}
+}
+
+func TestDiscover(t *testing.T) {
+	dir := t.TempDir()
+	configs := map[string]string{
+		"tun0.conf": "cd /etc/openvpn\nstatus tun0.status\nmanagement /run/openvpn/tun0.sock unix\n",
+		"tun1.conf": "status-version 3\nmanagement tun1.sock unix\n",
+	}
+	for name, config := range configs {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(config), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	instances, err := Discover([]string{filepath.Join(dir, "*.conf")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(instances) != 2 {
+		t.Fatalf("expected 2 instances, got %d", len(instances))
+	}
+	if instances[0].Name != "tun0" || instances[0].StatusPath != "/etc/openvpn/tun0.status" || instances[0].OpenVPNVersion() != "2.4" {
+		t.Errorf("unexpected instance %+v", instances[0])
+	}
+	if instances[1].StatusPath != "" || instances[1].Management != "unix://"+filepath.Join(dir, "tun1.sock") {
+		t.Errorf("unexpected instance %+v", instances[1])
+	}
+}
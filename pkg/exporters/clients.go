@@ -0,0 +1,225 @@
+package exporters
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// Client connected to an OpenVPN server, as listed in the CLIENT_LIST
+// section of its status.
+type Client struct {
+	CommonName     string
+	RealAddress    string
+	VirtualAddress string
+	Username       string
+	BytesReceived  float64
+	BytesSent      float64
+	ConnectedSince time.Time
+}
+
+// Status file or management interface of a server, along with the name
+// of the discovered instance it belongs to, if any, the time zone in
+// which it prints dates, if not that of the host, and the file containing
+// the password of its management interface, if any.
+type StatusSource struct {
+	Instance     string
+	StatusPath   string
+	Location     *time.Location
+	PasswordFile string
+}
+
+// Returns a string identifying the session of a client. A client that
+// reconnects gets a new session, even if it keeps its address.
+func (c Client) SessionKey() string {
+	return c.CommonName + "\xff" + c.RealAddress + "\xff" + strconv.FormatInt(c.ConnectedSince.Unix(), 10)
+}
+
+// Returned for statuses lacking the END line, usually because OpenVPN was
+// rewriting the status file while it was read.
+var errIncompleteStatus = errors.New("status is incomplete, as it lacks the END line")
+
+// Number of times an incomplete status is read again, and the time to
+// wait before every attempt, which is usually enough for OpenVPN to finish
+// rewriting it.
+var (
+	incompleteRetries    = 3
+	incompleteRetryDelay = 100 * time.Millisecond
+)
+
+// Reads the status of an OpenVPN server from a status file or, for
+// unix:// and tcp:// paths, from its management interface, logging in
+// with the password from the given file, if any.
+func ReadStatus(statusPath string, passwordFile string) ([]byte, error) {
+	if isManagementAddress(statusPath) {
+		status, _, err := readManagementStatus(statusPath, passwordFile)
+		return status, err
+	}
+	status, err := os.ReadFile(statusPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open status file %s: %s", statusPath, err)
+	}
+	return status, nil
+}
+
+// Reads the clients connected to an OpenVPN server, reading incomplete
+// statuses again.
+func ReadClientList(source StatusSource) ([]Client, error) {
+	for attempt := 0; ; attempt++ {
+		status, err := ReadStatus(source.StatusPath, source.PasswordFile)
+		if err != nil {
+			return nil, err
+		}
+		clients, err := ParseClientList(bytes.NewReader(status), source.Location)
+		if !errors.Is(err, errIncompleteStatus) || attempt >= incompleteRetries {
+			return clients, err
+		}
+		time.Sleep(incompleteRetryDelay)
+	}
+}
+
+// Parses the CLIENT_LIST section of a server status file in any of the
+// formats supported by the exporter. Status format version 1 lists
+// virtual addresses in the routing table only, so they are taken from
+// there. Status files of OpenVPN clients have no client list at all. Dates
+// are parsed in the given time zone or, if nil, that of the host.
+func ParseClientList(file io.Reader, location *time.Location) ([]Client, error) {
+	reader := bufio.NewReader(file)
+	buf, _ := reader.Peek(18)
+	list := &clientList{location: location, columns: map[*rowLayout]clientColumns{}, virtualAddresses: map[sessionKey]string{}}
+	var err error
+	if bytes.HasPrefix(buf, []byte("TITLE,")) {
+		err = parseServer23Status(reader, ",", list)
+	} else if bytes.HasPrefix(buf, []byte("TITLE\t")) {
+		err = parseServer23Status(reader, "\t", list)
+	} else if bytes.HasPrefix(buf, []byte("OpenVPN CLIENT LIS")) {
+		err = parseServer24Status(reader, ",", location, list)
+	} else if bytes.HasPrefix(buf, []byte("OpenVPN STATISTICS")) {
+		return nil, nil
+	} else {
+		return nil, fmt.Errorf("unexpected file contents: %q", buf)
+	}
+	if err != nil {
+		return nil, err
+	}
+	for i, client := range list.clients {
+		if client.VirtualAddress == "" {
+			list.clients[i].VirtualAddress = list.virtualAddresses[sessionKey{client.CommonName, client.RealAddress}]
+		}
+	}
+	return list.clients, nil
+}
+
+// Positions of the columns of a client list from which clients are built,
+// or -1 if the client list has no such column.
+type clientColumns struct {
+	bytesReceived      int
+	bytesSent          int
+	connectedSince     int
+	connectedSinceTime int
+	username           int
+}
+
+// Builds the client list of a server status from the rows of its client
+// list and routing table.
+type clientList struct {
+	location *time.Location
+	columns  map[*rowLayout]clientColumns
+	clients  []Client
+	// Addresses of the host routes of every session.
+	virtualAddresses map[sessionKey]string
+}
+
+func (l *clientList) newLayout(section string, columnNames []string) *rowLayout {
+	layout := newRowLayout(section, OpenvpnServerHeader{}, columnNames, DuplicateFirst)
+	l.columns[layout] = clientColumns{
+		bytesReceived:      slices.Index(columnNames, "Bytes Received"),
+		bytesSent:          slices.Index(columnNames, "Bytes Sent"),
+		connectedSince:     slices.Index(columnNames, "Connected Since"),
+		connectedSinceTime: slices.Index(columnNames, "Connected Since (time_t)"),
+		username:           slices.Index(columnNames, "Username"),
+	}
+	return layout
+}
+
+func (l *clientList) row(layout *rowLayout, row []string) error {
+	if layout.section == "ROUTING_TABLE" {
+		// Clients may have routes for subnets behind them as well, but
+		// only the address assigned to them is a host route.
+		if layout.virtualAddressIndex < 0 {
+			return nil
+		}
+		if address, kind := parseRoute(row[layout.virtualAddressIndex]); kind == routeHost {
+			session := rowSession(layout, row)
+			if _, ok := l.virtualAddresses[session]; !ok {
+				l.virtualAddresses[session] = address
+			}
+		}
+		return nil
+	}
+	client, err := newClient(layout, l.columns[layout], row, l.location)
+	if err != nil {
+		return err
+	}
+	l.clients = append(l.clients, client)
+	return nil
+}
+
+// The client list is complete once every row has been handled, and does
+// not include the title or update time of the status.
+func (l *clientList) endSection(*rowLayout) error {
+	return nil
+}
+
+func (l *clientList) title(string) error {
+	return nil
+}
+
+func (l *clientList) updated(float64) error {
+	return nil
+}
+
+// Returns the value of a column of a row, or an empty string if the
+// section has no such column.
+func columnValue(row []string, index int) string {
+	if index < 0 {
+		return ""
+	}
+	return row[index]
+}
+
+// Builds a client from a row of the client list.
+func newClient(layout *rowLayout, columns clientColumns, row []string, location *time.Location) (Client, error) {
+	client := Client{
+		CommonName:     columnValue(row, layout.commonNameIndex),
+		RealAddress:    columnValue(row, layout.realAddressIndex),
+		VirtualAddress: columnValue(row, layout.virtualAddressIndex),
+		Username:       columnValue(row, columns.username),
+	}
+	var err error
+	if client.BytesReceived, err = strconv.ParseFloat(columnValue(row, columns.bytesReceived), 64); err != nil {
+		return client, fmt.Errorf("failed to parse bytes received: %s", err)
+	}
+	if client.BytesSent, err = strconv.ParseFloat(columnValue(row, columns.bytesSent), 64); err != nil {
+		return client, fmt.Errorf("failed to parse bytes sent: %s", err)
+	}
+	if columns.connectedSinceTime >= 0 {
+		timestamp, err := strconv.ParseInt(row[columns.connectedSinceTime], 10, 64)
+		if err != nil {
+			return client, fmt.Errorf("failed to parse connection time: %s", err)
+		}
+		client.ConnectedSince = time.Unix(timestamp, 0)
+	} else {
+		client.ConnectedSince, err = parseStatusTime(columnValue(row, columns.connectedSince), location)
+		if err != nil {
+			return client, fmt.Errorf("failed to parse connection time: %s", err)
+		}
+	}
+	return client, nil
+}
@@ -0,0 +1,88 @@
+package exporters
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestParseClientList(t *testing.T) {
+	for _, test := range []struct {
+		path     string
+		count    int
+		expected Client
+	}{
+		{
+			path:  "../../examples/version-2.3/server3.status",
+			count: 5,
+			expected: Client{
+				CommonName:     "redacted1",
+				RealAddress:    "0.0.0.0:19021",
+				VirtualAddress: "0.0.0.0",
+				Username:       "UNDEF",
+				BytesReceived:  693438277,
+				BytesSent:      228390856,
+				ConnectedSince: time.Unix(1489680543, 0),
+			},
+		},
+		{
+			path:  "../../examples/version-2.4/server.status",
+			count: 4,
+			expected: Client{
+				CommonName:     "client1",
+				RealAddress:    "193.56.104.177:52435",
+				VirtualAddress: "10.8.0.86",
+				BytesReceived:  621910,
+				BytesSent:      1070013,
+				ConnectedSince: time.Date(2024, 9, 18, 9, 8, 11, 0, time.UTC),
+			},
+		},
+	} {
+		file, err := os.Open(test.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		clients, err := ParseClientList(file, time.UTC)
+		file.Close()
+		if err != nil {
+			t.Fatalf("%s: %s", test.path, err)
+		}
+		if len(clients) < test.count {
+			t.Fatalf("%s: expected at least %d clients, got %d", test.path, test.count, len(clients))
+		}
+		if !clients[0].ConnectedSince.Equal(test.expected.ConnectedSince) {
+			t.Errorf("%s: expected connection time %s, got %s", test.path, test.expected.ConnectedSince, clients[0].ConnectedSince)
+		}
+		clients[0].ConnectedSince = test.expected.ConnectedSince
+		if clients[0] != test.expected {
+			t.Errorf("%s: expected %+v, got %+v", test.path, test.expected, clients[0])
+		}
+	}
+}
+
+// The client list is parsed by the same parser as the exporter, so it
+// rejects the same statuses.
+func TestParseClientListErrors(t *testing.T) {
+	for _, status := range []string{
+		"TITLE,OpenVPN 2.3.2\nCLIENT_LIST,alice,198.51.100.1:1194,10.8.0.6,1,2,Thu Mar 16 17:09:03 2017,1489680543,UNDEF\nEND\n",
+		"TITLE,OpenVPN 2.3.2\nHEADER,CLIENT_LIST,Common Name,Real Address\nCLIENT_LIST,alice\nEND\n",
+		"TITLE,OpenVPN 2.3.2\nUNKNOWN,value\nEND\n",
+		"OpenVPN CLIENT LIST\nUpdated,yesterday\nEND\n",
+		"OpenVPN CLIENT LIST\nUpdated,Wed Sep 18 10:46:33 2024\n",
+	} {
+		e, err := NewOpenVPNExporter(nil, false, "2.4")
+		if err != nil {
+			t.Fatal(err)
+		}
+		collectErr := e.collectStatusFromReader("server.status", strings.NewReader(status), make(chan prometheus.Metric, 16))
+		if collectErr == nil {
+			t.Fatalf("%q: expected error", status)
+		}
+		if _, err := ParseClientList(strings.NewReader(status), nil); err == nil || err.Error() != collectErr.Error() {
+			t.Errorf("%q: expected error %v, got %v", status, collectErr, err)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package exporters
+
+import (
+	"log/slog"
+	"slices"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Client session, identified by its common name and real address, which
+// both the client list and the routing table of a status contain.
+type sessionKey struct {
+	commonName  string
+	realAddress string
+}
+
+type routeEntry struct {
+	session sessionKey
+	address string
+}
+
+// Cross-checks the client list and routing table of a server status. Each
+// route should belong to a connected client, each client should have a
+// route and each virtual address should be held by a single client.
+type statusCheck struct {
+	// Sessions of the client list, and whether they have a route.
+	sessions    map[sessionKey]bool
+	commonNames map[string]int
+	// Sessions holding every virtual address.
+	holders map[string][]sessionKey
+	routes  []routeEntry
+}
+
+func newStatusCheck() *statusCheck {
+	return &statusCheck{
+		sessions:    map[sessionKey]bool{},
+		commonNames: map[string]int{},
+		holders:     map[string][]sessionKey{},
+	}
+}
+
+func rowSession(layout *rowLayout, row []string) sessionKey {
+	var session sessionKey
+	if layout.commonNameIndex >= 0 {
+		session.commonName = row[layout.commonNameIndex]
+	}
+	if layout.realAddressIndex >= 0 {
+		session.realAddress = row[layout.realAddressIndex]
+	}
+	return session
+}
+
+// Records a row of a client list.
+func (c *statusCheck) addClient(layout *rowLayout, row []string) {
+	session := rowSession(layout, row)
+	c.sessions[session] = false
+	c.commonNames[session.commonName]++
+	if layout.virtualAddressIndex >= 0 && row[layout.virtualAddressIndex] != "" {
+		c.hold(row[layout.virtualAddressIndex], session)
+	}
+}
+
+// Records a row of a routing table.
+func (c *statusCheck) addRoute(layout *rowLayout, row []string) {
+	if layout.virtualAddressIndex < 0 {
+		return
+	}
+	session := rowSession(layout, row)
+	address, kind := parseRoute(row[layout.virtualAddressIndex])
+	c.routes = append(c.routes, routeEntry{session, address})
+	if kind == routeHost {
+		c.hold(address, session)
+	}
+}
+
+func (c *statusCheck) hold(address string, session sessionKey) {
+	if !slices.Contains(c.holders[address], session) {
+		c.holders[address] = append(c.holders[address], session)
+	}
+}
+
+// Number of inconsistencies of each kind found in a status.
+type checkResult struct {
+	orphanRoutes                int
+	clientsWithoutRoute         int
+	virtualAddressConflicts     int
+	duplicateCommonNameSessions int
+}
+
+// Counts the inconsistencies between the client list and routing table,
+// logging the details of each at debug level.
+func (c *statusCheck) check(statusPath string) checkResult {
+	var result checkResult
+	for _, route := range c.routes {
+		if _, ok := c.sessions[route.session]; !ok {
+			result.orphanRoutes++
+			slog.Debug("Route does not belong to a connected client", "status_path", statusPath, "virtual_address", route.address, "common_name", route.session.commonName, "real_address", route.session.realAddress)
+			continue
+		}
+		c.sessions[route.session] = true
+	}
+	for session, routed := range c.sessions {
+		if !routed {
+			result.clientsWithoutRoute++
+			slog.Debug("Client has no route", "status_path", statusPath, "common_name", session.commonName, "real_address", session.realAddress)
+		}
+	}
+	for address, sessions := range c.holders {
+		if len(sessions) > 1 {
+			result.virtualAddressConflicts++
+			commonNames := make([]string, len(sessions))
+			for i, session := range sessions {
+				commonNames[i] = session.commonName
+			}
+			slog.Debug("Virtual address is held by more than one client", "status_path", statusPath, "virtual_address", address, "common_names", strings.Join(commonNames, ","))
+		}
+	}
+	for commonName, sessions := range c.commonNames {
+		if sessions > 1 {
+			result.duplicateCommonNameSessions += sessions - 1
+			slog.Debug("Common name is connected more than once", "status_path", statusPath, "common_name", commonName, "sessions", sessions)
+		}
+	}
+	return result
+}
+
+func (e *OpenVPNExporter) collectStatusCheck(statusPath string, c *statusCheck, ch chan<- prometheus.Metric) error {
+	result := c.check(statusPath)
+	for _, metric := range []struct {
+		desc  *prometheus.Desc
+		value int
+	}{
+		{e.openvpnOrphanRoutesDesc, result.orphanRoutes},
+		{e.openvpnClientsWithoutRouteDesc, result.clientsWithoutRoute},
+		{e.openvpnAddressConflictsDesc, result.virtualAddressConflicts},
+		{e.openvpnDuplicateSessionsDesc, result.duplicateCommonNameSessions},
+	} {
+		if err := sendMetric(ch,
+			metric.desc,
+			prometheus.GaugeValue,
+			float64(metric.value),
+			statusPath); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package exporters
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestStatusCheck(t *testing.T) {
+	// Bob holds the address of alice, carol is connected twice, of which
+	// once without a route, and dave has left a route behind. The cached
+	// route of alice's subnet is no conflict.
+	status := `TITLE,OpenVPN 2.6.12 x86_64-pc-linux-gnu
+TIME,Tue Mar 21 10:39:14 2017,1490089154
+HEADER,CLIENT_LIST,Common Name,Real Address,Virtual Address,Bytes Received,Bytes Sent,Connected Since,Connected Since (time_t),Username
+CLIENT_LIST,alice,198.51.100.1:1194,10.8.0.6,1,1,Thu Mar 16 17:09:03 2017,1489680543,UNDEF
+CLIENT_LIST,bob,198.51.100.2:1194,10.8.0.6,1,1,Thu Mar 16 17:09:03 2017,1489680543,UNDEF
+CLIENT_LIST,carol,198.51.100.3:1194,10.8.0.14,1,1,Thu Mar 16 17:09:03 2017,1489680543,UNDEF
+CLIENT_LIST,carol,198.51.100.4:1194,10.8.0.18,1,1,Thu Mar 16 17:09:03 2017,1489680543,UNDEF
+HEADER,ROUTING_TABLE,Virtual Address,Common Name,Real Address,Last Ref,Last Ref (time_t)
+ROUTING_TABLE,10.8.0.6,alice,198.51.100.1:1194,Tue Mar 21 10:26:48 2017,1490088408
+ROUTING_TABLE,10.1.0.0/24,alice,198.51.100.1:1194,Tue Mar 21 10:26:48 2017,1490088408
+ROUTING_TABLE,10.1.0.17C,alice,198.51.100.1:1194,Tue Mar 21 10:26:48 2017,1490088408
+ROUTING_TABLE,10.8.0.6,bob,198.51.100.2:1194,Tue Mar 21 10:26:48 2017,1490088408
+ROUTING_TABLE,10.8.0.14,carol,198.51.100.3:1194,Tue Mar 21 10:26:48 2017,1490088408
+ROUTING_TABLE,10.8.0.22,dave,198.51.100.5:1194,Tue Mar 21 10:26:48 2017,1490088408
+END
+`
+	statusPath := filepath.Join(t.TempDir(), "server.status")
+	if err := os.WriteFile(statusPath, []byte(status), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	e, err := NewOpenVPNExporter([]string{statusPath}, true, "2.3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `# HELP openvpn_server_clients_without_route Number of connected clients without an entry in the routing table.
+# TYPE openvpn_server_clients_without_route gauge
+openvpn_server_clients_without_route{status_path="` + statusPath + `"} 1
+# HELP openvpn_server_duplicate_common_name_sessions Number of client sessions beyond the first of common names that are connected more than once.
+# TYPE openvpn_server_duplicate_common_name_sessions gauge
+openvpn_server_duplicate_common_name_sessions{status_path="` + statusPath + `"} 1
+# HELP openvpn_server_orphan_routes Number of routing table entries whose common name and real address are not in the client list.
+# TYPE openvpn_server_orphan_routes gauge
+openvpn_server_orphan_routes{status_path="` + statusPath + `"} 1
+# HELP openvpn_server_virtual_address_conflicts Number of virtual addresses held by more than one client.
+# TYPE openvpn_server_virtual_address_conflicts gauge
+openvpn_server_virtual_address_conflicts{status_path="` + statusPath + `"} 1
+`
+	if err := testutil.CollectAndCompare(e, strings.NewReader(expected),
+		"openvpn_server_clients_without_route",
+		"openvpn_server_duplicate_common_name_sessions",
+		"openvpn_server_orphan_routes",
+		"openvpn_server_virtual_address_conflicts"); err != nil {
+		t.Error(err)
+	}
+}
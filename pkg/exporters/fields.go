@@ -0,0 +1,318 @@
+package exporters
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Reads lines of any length, unlike bufio.Scanner, with their line ending
+// removed. Lines may end in either LF or CRLF.
+type lineReader struct {
+	reader *bufio.Reader
+	line   string
+	err    error
+}
+
+func newLineReader(file io.Reader) *lineReader {
+	reader, ok := file.(*bufio.Reader)
+	if !ok {
+		reader = bufio.NewReader(file)
+	}
+	return &lineReader{reader: reader}
+}
+
+// Advances to the next line, returning false at the end of the input or
+// on error.
+func (l *lineReader) Scan() bool {
+	if l.err != nil {
+		return false
+	}
+	line, err := l.reader.ReadString('\n')
+	if err != nil {
+		l.err = err
+		// The last line need not be terminated.
+		if err != io.EOF || line == "" {
+			return false
+		}
+	}
+	line = strings.TrimSuffix(line, "\n")
+	l.line = strings.TrimSuffix(line, "\r")
+	return true
+}
+
+func (l *lineReader) Text() string {
+	return l.line
+}
+
+func (l *lineReader) Err() error {
+	if l.err == io.EOF {
+		return nil
+	}
+	return l.err
+}
+
+// Returns the error of a line that failed to parse as an incomplete
+// status if no END line follows it, as the line was then most likely cut
+// short while OpenVPN was rewriting the status, e.g. in the middle of a
+// row.
+func (l *lineReader) parseError(err error) error {
+	if errors.Is(err, errIncompleteStatus) || l.Err() != nil {
+		return err
+	}
+	for l.Scan() {
+		if l.Text() == "END" {
+			return err
+		}
+	}
+	if l.Err() != nil {
+		return err
+	}
+	return fmt.Errorf("%w: %w", errIncompleteStatus, err)
+}
+
+// Parses a date as printed by OpenVPN, which does not include the time
+// zone, in the given time zone or, if nil, that of the host.
+func parseStatusTime(value string, location *time.Location) (time.Time, error) {
+	if location == nil {
+		location = time.Local
+	}
+	return time.ParseInLocation(time.ANSIC, value, location)
+}
+
+// Splits a line into fields, reusing the given slice.
+func splitFields(fields []string, line string, separator string) []string {
+	fields = fields[:0]
+	for {
+		i := strings.Index(line, separator)
+		if i < 0 {
+			return append(fields, line)
+		}
+		fields = append(fields, line[:i])
+		line = line[i+len(separator):]
+	}
+}
+
+// Columns that may contain arbitrary text. OpenVPN does not escape
+// separators in status files. It only replaces non-printable characters
+// in common names and usernames with underscores, so they cannot contain
+// tabs, but may contain commas.
+var freeTextColumns = map[string]bool{
+	"Common Name": true,
+	"Username":    true,
+}
+
+// Columns that always contain numbers, used to tell which of several ways
+// of joining surplus fields is the right one.
+var numericColumns = map[string]bool{
+	"Bytes Received":           true,
+	"Bytes Sent":               true,
+	"Connected Since (time_t)": true,
+	"Last Ref (time_t)":        true,
+	"Client ID":                true,
+	"Peer ID":                  true,
+}
+
+// Matches the fields of a row to the columns of its section. A row with
+// more fields than columns has separators in its free text columns, so
+// the surplus fields are joined into those columns. If a row has several
+// free text columns, the surplus is distributed among them such that the
+// other columns hold plausible values, preferring earlier columns.
+// Reports false if the fields cannot be matched to the columns.
+func fitColumns(fields []string, columnNames []string, separator string) ([]string, bool) {
+	if len(fields) == len(columnNames) {
+		return fields, true
+	}
+	if len(fields) < len(columnNames) {
+		return nil, false
+	}
+	var freeText []int
+	for i, column := range columnNames {
+		if freeTextColumns[column] {
+			freeText = append(freeText, i)
+		}
+	}
+	if len(freeText) == 0 {
+		return nil, false
+	}
+	extra := make([]int, len(columnNames))
+	return distributeFields(fields, columnNames, separator, freeText, extra, len(fields)-len(columnNames))
+}
+
+// Tries all ways of distributing the given number of surplus fields among
+// the remaining free text columns, in which extra[i] is the number of
+// surplus fields joined into column i.
+func distributeFields(fields []string, columnNames []string, separator string, freeText []int, extra []int, surplus int) ([]string, bool) {
+	if len(freeText) == 1 {
+		extra[freeText[0]] = surplus
+		row := joinFields(fields, columnNames, separator, extra)
+		return row, plausibleRow(row, columnNames)
+	}
+	for n := surplus; n >= 0; n-- {
+		extra[freeText[0]] = n
+		if row, ok := distributeFields(fields, columnNames, separator, freeText[1:], extra, surplus-n); ok {
+			return row, true
+		}
+	}
+	extra[freeText[0]] = 0
+	return nil, false
+}
+
+// Joins fields into columns, given the number of surplus fields of every
+// column.
+func joinFields(fields []string, columnNames []string, separator string, extra []int) []string {
+	row := make([]string, len(columnNames))
+	for i := range columnNames {
+		row[i] = strings.Join(fields[:1+extra[i]], separator)
+		fields = fields[1+extra[i]:]
+	}
+	return row
+}
+
+// Reports whether the columns of a row that cannot contain separators
+// hold values of the expected form.
+func plausibleRow(row []string, columnNames []string) bool {
+	for i, column := range columnNames {
+		if numericColumns[column] && row[i] != "" {
+			if _, err := strconv.ParseFloat(row[i], 64); err != nil {
+				return false
+			}
+		}
+		// Real addresses always include a port.
+		if column == "Real Address" && !strings.Contains(row[i], ":") {
+			return false
+		}
+	}
+	return true
+}
+
+// Build of OpenVPN described by the TITLE line of a status, such as
+// "OpenVPN 2.4.4 x86_64-pc-linux-gnu [SSL (OpenSSL)] [LZO] [EPOLL] built
+// on Feb 10 2018".
+type serverBuild struct {
+	version    string
+	platform   string
+	sslLibrary string
+	features   []string
+}
+
+// Parses the TITLE line of a status, returning false if it does not
+// describe an OpenVPN build.
+func parseTitle(title string) (serverBuild, bool) {
+	head, flags, _ := strings.Cut(title, "[")
+	words := strings.Fields(head)
+	if len(words) < 2 || words[0] != "OpenVPN" {
+		return serverBuild{}, false
+	}
+	build := serverBuild{version: words[1]}
+	if len(words) > 2 {
+		build.platform = words[2]
+	}
+	// Flags are enclosed in brackets and may contain spaces, such as
+	// [SSL (OpenSSL)] or [MH/PKTINFO].
+	for flags != "" {
+		flag, rest, ok := strings.Cut(flags, "]")
+		if !ok {
+			break
+		}
+		if library, ok := strings.CutPrefix(flag, "SSL ("); ok {
+			build.sslLibrary = strings.TrimSuffix(library, ")")
+		} else if flag != "" && !slices.Contains(build.features, flag) {
+			build.features = append(build.features, flag)
+		}
+		_, flags, _ = strings.Cut(rest, "[")
+	}
+	return build, true
+}
+
+// Address from which a client connects, as printed in the Real Address
+// column, such as 198.51.100.1:1194, udp4:198.51.100.1:1194 or
+// tcp6-server:[2001:db8::1]:50000.
+type realAddress struct {
+	// Transport protocol, udp or tcp, if printed.
+	proto string
+	// Address family, ipv4 or ipv6, if known.
+	family string
+	ip     string
+	port   string
+}
+
+// Splits a real address into its protocol, IP address and port. Addresses
+// of IPv4 clients of dual-stack sockets are reported as IPv4 addresses.
+func parseRealAddress(value string) realAddress {
+	var address realAddress
+	if prefix, rest, ok := strings.Cut(value, ":"); ok {
+		proto := strings.TrimSuffix(strings.TrimSuffix(prefix, "-server"), "-client")
+		family := ""
+		if p, ok := strings.CutSuffix(proto, "4"); ok {
+			proto, family = p, "ipv4"
+		} else if p, ok := strings.CutSuffix(proto, "6"); ok {
+			proto, family = p, "ipv6"
+		}
+		if proto == "udp" || proto == "tcp" {
+			address.proto, address.family = proto, family
+			value = rest
+		}
+	}
+
+	host := value
+	if strings.HasPrefix(value, "[") {
+		if h, port, err := net.SplitHostPort(value); err == nil {
+			host, address.port = h, port
+		}
+	} else if i := strings.LastIndex(value, ":"); i >= 0 {
+		// Without brackets, the last colon of an IPv6 address only
+		// separates the port if the remainder is an address itself.
+		_, err := netip.ParseAddr(value[:i])
+		if strings.Count(value, ":") == 1 || err == nil {
+			host, address.port = value[:i], value[i+1:]
+		}
+	}
+	address.ip = host
+	if ip, err := netip.ParseAddr(host); err == nil {
+		ip = ip.Unmap()
+		address.ip = ip.String()
+		if ip.Is4() {
+			address.family = "ipv4"
+		} else {
+			address.family = "ipv6"
+		}
+	}
+	return address
+}
+
+// Kinds of entries of the routing table of a server.
+const (
+	routeHost   = "host"
+	routeSubnet = "subnet"
+	routeMAC    = "mac"
+	routeCached = "cached"
+)
+
+var routeKinds = []string{routeHost, routeSubnet, routeMAC, routeCached}
+
+// Determines the kind of a routing table entry from its virtual address,
+// returning the address without flags. Entries are host addresses,
+// subnets routed to a client with --iroute, or MAC addresses in TAP mode,
+// optionally followed by @ and a VLAN. Host addresses the server learned
+// from packets routed to a subnet are marked as cached with a trailing C.
+func parseRoute(value string) (string, string) {
+	if address, ok := strings.CutSuffix(value, "C"); ok {
+		return address, routeCached
+	}
+	mac, _, _ := strings.Cut(value, "@")
+	if _, err := net.ParseMAC(mac); err == nil {
+		return value, routeMAC
+	}
+	if strings.Contains(value, "/") {
+		return value, routeSubnet
+	}
+	return value, routeHost
+}
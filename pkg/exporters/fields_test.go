@@ -0,0 +1,247 @@
+package exporters
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestLineReader(t *testing.T) {
+	long := strings.Repeat("x", 1<<20)
+	tests := []struct {
+		input string
+		want  []string
+	}{
+		{"a\nb\n", []string{"a", "b"}},
+		{"a\r\nb\r\n", []string{"a", "b"}},
+		{"a\r\nb", []string{"a", "b"}},
+		{"a\n\nb\n", []string{"a", "", "b"}},
+		{"a\rb\n", []string{"a\rb"}},
+		{"", nil},
+		{long + "\nEND\n", []string{long, "END"}},
+	}
+	for _, test := range tests {
+		reader := newLineReader(strings.NewReader(test.input))
+		var lines []string
+		for reader.Scan() {
+			lines = append(lines, reader.Text())
+		}
+		if err := reader.Err(); err != nil {
+			t.Errorf("%.20q: %s", test.input, err)
+		}
+		if !slices.Equal(lines, test.want) {
+			t.Errorf("%.20q: expected %d lines %.40q, got %d lines %.40q", test.input, len(test.want), test.want, len(lines), lines)
+		}
+	}
+}
+
+func TestFitColumns(t *testing.T) {
+	clientList23 := []string{"Common Name", "Real Address", "Virtual Address", "Bytes Received", "Bytes Sent", "Connected Since", "Connected Since (time_t)", "Username"}
+	clientList24 := []string{"Common Name", "Real Address", "Bytes Received", "Bytes Sent", "Connected Since"}
+	routingTable24 := []string{"Virtual Address", "Common Name", "Real Address", "Last Ref"}
+	tests := []struct {
+		name    string
+		line    string
+		columns []string
+		want    []string
+	}{
+		{
+			"plain",
+			"client1,198.51.100.1:1194,10.8.0.6,1,2,Thu Mar 16 17:09:03 2017,1489680543,UNDEF",
+			clientList23,
+			[]string{"client1", "198.51.100.1:1194", "10.8.0.6", "1", "2", "Thu Mar 16 17:09:03 2017", "1489680543", "UNDEF"},
+		},
+		{
+			"comma in common name",
+			"Doe, John,198.51.100.1:1194,10.8.0.6,1,2,Thu Mar 16 17:09:03 2017,1489680543,UNDEF",
+			clientList23,
+			[]string{"Doe, John", "198.51.100.1:1194", "10.8.0.6", "1", "2", "Thu Mar 16 17:09:03 2017", "1489680543", "UNDEF"},
+		},
+		{
+			"commas in common name and username",
+			"CN=a,O=b,198.51.100.1:1194,10.8.0.6,1,2,Thu Mar 16 17:09:03 2017,1489680543,doe,john",
+			clientList23,
+			[]string{"CN=a,O=b", "198.51.100.1:1194", "10.8.0.6", "1", "2", "Thu Mar 16 17:09:03 2017", "1489680543", "doe,john"},
+		},
+		{
+			"comma in username only",
+			"client1,198.51.100.1:1194,10.8.0.6,1,2,Thu Mar 16 17:09:03 2017,1489680543,doe,john",
+			clientList23,
+			[]string{"client1", "198.51.100.1:1194", "10.8.0.6", "1", "2", "Thu Mar 16 17:09:03 2017", "1489680543", "doe,john"},
+		},
+		{
+			"common name of separators only",
+			",,,198.51.100.1:1194,1,2,Wed Sep 18 09:08:11 2024",
+			clientList24,
+			[]string{",,", "198.51.100.1:1194", "1", "2", "Wed Sep 18 09:08:11 2024"},
+		},
+		{
+			"empty common name",
+			",198.51.100.1:1194,1,2,Wed Sep 18 09:08:11 2024",
+			clientList24,
+			[]string{"", "198.51.100.1:1194", "1", "2", "Wed Sep 18 09:08:11 2024"},
+		},
+		{
+			"quotes and spaces",
+			`"O'Brien", Ann ,198.51.100.1:1194,1,2,Wed Sep 18 09:08:11 2024`,
+			clientList24,
+			[]string{`"O'Brien", Ann `, "198.51.100.1:1194", "1", "2", "Wed Sep 18 09:08:11 2024"},
+		},
+		{
+			"non-ASCII common name",
+			"Müller, Jürgen,198.51.100.1:1194,1,2,Wed Sep 18 09:08:11 2024",
+			clientList24,
+			[]string{"Müller, Jürgen", "198.51.100.1:1194", "1", "2", "Wed Sep 18 09:08:11 2024"},
+		},
+		{
+			"comma in routing table",
+			"10.8.0.6,Doe, John,198.51.100.1:1194,Wed Sep 18 10:46:28 2024",
+			routingTable24,
+			[]string{"10.8.0.6", "Doe, John", "198.51.100.1:1194", "Wed Sep 18 10:46:28 2024"},
+		},
+		{
+			"too few fields",
+			"client1,198.51.100.1:1194,1,2",
+			clientList24,
+			nil,
+		},
+		{
+			"too many fields without free text",
+			"10.8.0.6,client1,198.51.100.1:1194,Wed Sep 18 10:46:28 2024,extra",
+			[]string{"Virtual Address", "Real Address", "Last Ref"},
+			nil,
+		},
+	}
+	for _, test := range tests {
+		row, ok := fitColumns(strings.Split(test.line, ","), test.columns, ",")
+		if ok != (test.want != nil) || !slices.Equal(row, test.want) {
+			t.Errorf("%s: expected %q, got %q", test.name, test.want, row)
+		}
+	}
+}
+
+func TestParseClientListAwkwardNames(t *testing.T) {
+	tests := []struct {
+		name   string
+		status string
+	}{
+		{
+			"version 2",
+			"TITLE,OpenVPN 2.3.2\r\nTIME,Tue Mar 21 10:39:14 2017,1490089154\r\n" +
+				"HEADER,CLIENT_LIST,Common Name,Real Address,Virtual Address,Bytes Received,Bytes Sent,Connected Since,Connected Since (time_t),Username\r\n" +
+				"CLIENT_LIST,Doe, John,198.51.100.1:1194,10.8.0.6,1,2,Thu Mar 16 17:09:03 2017,1489680543,doe,john\r\n" +
+				"END\r\n",
+		},
+		{
+			"version 3",
+			"TITLE\tOpenVPN 2.3.2\nTIME\tTue Mar 21 10:39:14 2017\t1490089154\n" +
+				"HEADER\tCLIENT_LIST\tCommon Name\tReal Address\tVirtual Address\tBytes Received\tBytes Sent\tConnected Since\tConnected Since (time_t)\tUsername\n" +
+				"CLIENT_LIST\tDoe, John\t198.51.100.1:1194\t10.8.0.6\t1\t2\tThu Mar 16 17:09:03 2017\t1489680543\tdoe,john\n" +
+				"END\n",
+		},
+		{
+			"version 1",
+			"OpenVPN CLIENT LIST\r\nUpdated,Wed Sep 18 10:46:33 2024\r\n" +
+				"Common Name,Real Address,Bytes Received,Bytes Sent,Connected Since\r\n" +
+				"Doe, John,198.51.100.1:1194,1,2,Wed Sep 18 09:08:11 2024\r\n" +
+				"ROUTING TABLE\r\nVirtual Address,Common Name,Real Address,Last Ref\r\n" +
+				"10.8.0.6,Doe, John,198.51.100.1:1194,Wed Sep 18 10:46:28 2024\r\n" +
+				"GLOBAL STATS\r\nMax bcast/mcast queue length,0\r\nEND\r\n",
+		},
+	}
+	for _, test := range tests {
+		clients, err := ParseClientList(strings.NewReader(test.status), nil)
+		if err != nil {
+			t.Errorf("%s: %s", test.name, err)
+			continue
+		}
+		if len(clients) != 1 || clients[0].CommonName != "Doe, John" || clients[0].VirtualAddress != "10.8.0.6" || clients[0].BytesSent != 2 {
+			t.Errorf("%s: unexpected clients %+v", test.name, clients)
+		}
+
+		for _, version := range []string{"2.3", "2.4"} {
+			e, err := NewOpenVPNExporter(nil, false, version)
+			if err != nil {
+				t.Fatal(err)
+			}
+			collectSynthetic(t, e, []byte(test.status))
+		}
+	}
+}
+
+func TestParseTitle(t *testing.T) {
+	tests := []struct {
+		title string
+		want  serverBuild
+		ok    bool
+	}{
+		{
+			"OpenVPN 2.3.2 x86_64-pc-linux-gnu [SSL (OpenSSL)] [LZO] [EPOLL] [PKCS11] [eurephia] [MH] [IPv6] built on Dec  2 2014",
+			serverBuild{"2.3.2", "x86_64-pc-linux-gnu", "OpenSSL", []string{"LZO", "EPOLL", "PKCS11", "eurephia", "MH", "IPv6"}},
+			true,
+		},
+		{
+			"OpenVPN 2.6.12 x86_64-w64-mingw32 [SSL (mbed TLS)] [LZ4] [MH/PKTINFO] [AEAD] [DCO] [LZ4]",
+			serverBuild{"2.6.12", "x86_64-w64-mingw32", "mbed TLS", []string{"LZ4", "MH/PKTINFO", "AEAD", "DCO"}},
+			true,
+		},
+		{"OpenVPN 2.6.12", serverBuild{version: "2.6.12"}, true},
+		{"OpenVPN 2.5.0 arm-openwrt-linux [SSL (OpenSSL)] [LZO", serverBuild{"2.5.0", "arm-openwrt-linux", "OpenSSL", nil}, true},
+		{"Some other VPN 1.0", serverBuild{}, false},
+		{"", serverBuild{}, false},
+	}
+	for _, test := range tests {
+		build, ok := parseTitle(test.title)
+		if ok != test.ok ||
+			build.version != test.want.version ||
+			build.platform != test.want.platform ||
+			build.sslLibrary != test.want.sslLibrary ||
+			!slices.Equal(build.features, test.want.features) {
+			t.Errorf("%q: expected %+v, %t, got %+v, %t", test.title, test.want, test.ok, build, ok)
+		}
+	}
+}
+
+func TestParseRealAddress(t *testing.T) {
+	tests := []struct {
+		value string
+		want  realAddress
+	}{
+		{"198.51.100.1:1194", realAddress{"", "ipv4", "198.51.100.1", "1194"}},
+		{"udp4:198.51.100.1:1194", realAddress{"udp", "ipv4", "198.51.100.1", "1194"}},
+		{"tcp4-server:198.51.100.1:50000", realAddress{"tcp", "ipv4", "198.51.100.1", "50000"}},
+		{"udp6:[2001:db8::1]:1194", realAddress{"udp", "ipv6", "2001:db8::1", "1194"}},
+		{"[2001:db8::1]:1194", realAddress{"", "ipv6", "2001:db8::1", "1194"}},
+		{"tcp6-server:2001:db8::1:50000", realAddress{"tcp", "ipv6", "2001:db8::1", "50000"}},
+		{"udp6:[::ffff:198.51.100.1]:1194", realAddress{"udp", "ipv4", "198.51.100.1", "1194"}},
+		{"udp:vpn.example.com:1194", realAddress{"udp", "", "vpn.example.com", "1194"}},
+		{"2001:db8::1", realAddress{"", "ipv6", "2001:db8::1", ""}},
+		{"", realAddress{}},
+	}
+	for _, test := range tests {
+		if address := parseRealAddress(test.value); address != test.want {
+			t.Errorf("%q: expected %+v, got %+v", test.value, test.want, address)
+		}
+	}
+}
+
+func TestParseRoute(t *testing.T) {
+	tests := []struct {
+		value   string
+		address string
+		kind    string
+	}{
+		{"10.8.0.6", "10.8.0.6", routeHost},
+		{"2001:db8::1000", "2001:db8::1000", routeHost},
+		{"10.1.0.0/24", "10.1.0.0/24", routeSubnet},
+		{"2001:db8:1::/64", "2001:db8:1::/64", routeSubnet},
+		{"10.1.0.17C", "10.1.0.17", routeCached},
+		{"ae:12:34:56:78:9a", "ae:12:34:56:78:9a", routeMAC},
+		{"ae:12:34:56:78:9a@10", "ae:12:34:56:78:9a@10", routeMAC},
+	}
+	for _, test := range tests {
+		if address, kind := parseRoute(test.value); address != test.address || kind != test.kind {
+			t.Errorf("%q: expected %q of kind %s, got %q of kind %s", test.value, test.address, test.kind, address, kind)
+		}
+	}
+}
@@ -1,16 +1,75 @@
 package exporters
 
-import "slices"
+import (
+	"hash/maphash"
+	"slices"
+	"strings"
+	"unicode/utf8"
 
-// Is a sub-slice of slice
-func subslice(sub []string, main []string) bool {
-	if len(sub) > len(main) {
-		return false
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Set of label value tuples, indexed by their hash. Tuples with the same
+// hash are compared in full, so that distinct tuples are never mistaken
+// for one another.
+type labelSet struct {
+	hash    maphash.Hash
+	indexes map[uint64][]int
+	// Tuples in the order they were added.
+	tuples [][]string
+}
+
+func newLabelSet() *labelSet {
+	return &labelSet{indexes: map[uint64][]int{}}
+}
+
+// Adds a tuple to the set unless it is present already. Returns the
+// position of the tuple in the order tuples were added, and whether it
+// was added. The tuple is retained, so it must not be modified afterwards.
+func (s *labelSet) add(labels []string) (int, bool) {
+	s.hash.Reset()
+	for _, label := range labels {
+		s.hash.WriteString(label)
+		s.hash.WriteByte(0)
 	}
-	for _, s := range sub {
-		if !slices.Contains(main, s) {
-			return false
+	sum := s.hash.Sum64()
+	for _, index := range s.indexes[sum] {
+		if slices.Equal(s.tuples[index], labels) {
+			return index, false
 		}
 	}
-	return true
+	s.indexes[sum] = append(s.indexes[sum], len(s.tuples))
+	s.tuples = append(s.tuples, labels)
+	return len(s.tuples) - 1, true
+}
+
+// Replaces invalid UTF-8 in label values, e.g. in common names of
+// certificates issued by foreign CAs, which Prometheus rejects. The label
+// values given are left unchanged, a copy is returned if any is replaced.
+func sanitizeLabelValues(labelValues []string) []string {
+	var sanitized []string
+	for i, value := range labelValues {
+		if !utf8.ValidString(value) {
+			if sanitized == nil {
+				sanitized = slices.Clone(labelValues)
+			}
+			sanitized[i] = strings.ToValidUTF8(value, "�")
+		}
+	}
+	if sanitized == nil {
+		return labelValues
+	}
+	return sanitized
+}
+
+// Sends a metric with sanitized label values. Unlike
+// prometheus.MustNewConstMetric, it returns an error instead of panicking
+// if the metric cannot be built.
+func sendMetric(ch chan<- prometheus.Metric, desc *prometheus.Desc, valueType prometheus.ValueType, value float64, labelValues ...string) error {
+	metric, err := prometheus.NewConstMetric(desc, valueType, value, sanitizeLabelValues(labelValues)...)
+	if err != nil {
+		return err
+	}
+	ch <- metric
+	return nil
 }
@@ -0,0 +1,284 @@
+package exporters
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/netip"
+	"os"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Range of IPv4 addresses handed out by OpenVPN's --ifconfig-pool. With
+// the net30 topology every client occupies a /30, so only every fourth
+// address is counted as a slot.
+type IPPool struct {
+	Start netip.Addr
+	End   netip.Addr
+	Step  uint32
+}
+
+type IPPSource struct {
+	Path string
+	Pool IPPool
+}
+
+type IPPEntry struct {
+	CommonName     string
+	VirtualAddress string
+	VirtualIPv6    string
+}
+
+type IPPExporter struct {
+	sources       []IPPSource
+	exportClients bool
+
+	ippUpDesc           *prometheus.Desc
+	ippPoolSizeDesc     *prometheus.Desc
+	ippPoolAssignedDesc *prometheus.Desc
+	ippPoolFreeDesc     *prometheus.Desc
+	ippClientInfoDesc   *prometheus.Desc
+}
+
+func addrToUint32(addr netip.Addr) uint32 {
+	b := addr.As4()
+	return binary.BigEndian.Uint32(b[:])
+}
+
+func uint32ToAddr(value uint32) netip.Addr {
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], value)
+	return netip.AddrFrom4(b)
+}
+
+func topologyStep(topology string) (uint32, error) {
+	switch topology {
+	case "net30":
+		return 4, nil
+	case "p2p", "subnet":
+		return 1, nil
+	}
+	return 0, fmt.Errorf("unsupported topology: %q", topology)
+}
+
+// Derives the address pool in the same way OpenVPN expands the --server
+// directive for the given network and topology.
+func NewIPPoolFromServer(network netip.Prefix, topology string) (IPPool, error) {
+	step, err := topologyStep(topology)
+	if err != nil {
+		return IPPool{}, err
+	}
+	if !network.Addr().Is4() {
+		return IPPool{}, fmt.Errorf("server network must be IPv4: %s", network)
+	}
+	if network.Bits() > 29 {
+		return IPPool{}, fmt.Errorf("server network is too small: %s", network)
+	}
+	first := addrToUint32(network.Masked().Addr())
+	last := first | (1<<(32-network.Bits()) - 1)
+	// With net30 and p2p, the server uses the first /30 of the network
+	// and the pool ends before the last one. With subnet, the server only
+	// uses the first host address.
+	start, end := first+4, last-4
+	if topology == "subnet" {
+		start, end = first+2, last-2
+	}
+	if end < start {
+		return IPPool{}, fmt.Errorf("server network is too small: %s", network)
+	}
+	return IPPool{Start: uint32ToAddr(start), End: uint32ToAddr(end), Step: step}, nil
+}
+
+// Parses a pool given either as the network passed to --server (e.g.
+// 10.8.0.0/24) or as the start and end addresses of --ifconfig-pool (e.g.
+// 10.8.0.4-10.8.0.251).
+func ParseIPPool(pool string, topology string) (IPPool, error) {
+	if startValue, endValue, ok := strings.Cut(pool, "-"); ok {
+		step, err := topologyStep(topology)
+		if err != nil {
+			return IPPool{}, err
+		}
+		start, err := netip.ParseAddr(strings.TrimSpace(startValue))
+		if err != nil {
+			return IPPool{}, err
+		}
+		end, err := netip.ParseAddr(strings.TrimSpace(endValue))
+		if err != nil {
+			return IPPool{}, err
+		}
+		if !start.Is4() || !end.Is4() || end.Less(start) {
+			return IPPool{}, fmt.Errorf("invalid IPv4 pool range: %s", pool)
+		}
+		return IPPool{Start: start, End: end, Step: step}, nil
+	}
+	network, err := netip.ParsePrefix(pool)
+	if err != nil {
+		return IPPool{}, err
+	}
+	return NewIPPoolFromServer(network, topology)
+}
+
+func (p IPPool) Size() int {
+	return int((addrToUint32(p.End)-addrToUint32(p.Start))/p.Step) + 1
+}
+
+// Returns the index of the pool slot an address belongs to. Any address
+// within a net30 subnet maps to the slot of that subnet.
+func (p IPPool) Slot(addr netip.Addr) (int, bool) {
+	if !addr.Is4() || addr.Less(p.Start) || p.End.Less(addr) {
+		return 0, false
+	}
+	return int((addrToUint32(addr) - addrToUint32(p.Start)) / p.Step), true
+}
+
+func (p IPPool) String() string {
+	return fmt.Sprintf("%s-%s", p.Start, p.End)
+}
+
+// Parses an --ifconfig-pool-persist file. Every line consists of a common
+// name followed by the persisted IPv4 address and, since OpenVPN 2.6, an
+// IPv6 address.
+func parseIPP(file io.Reader) ([]IPPEntry, error) {
+	var entries []IPPEntry
+	scanner := bufio.NewScanner(file)
+	scanner.Split(bufio.ScanLines)
+	for scanner.Scan() {
+		if scanner.Text() == "" {
+			continue
+		}
+		fields := strings.Split(scanner.Text(), ",")
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("unexpected ifconfig-pool-persist entry: %q", scanner.Text())
+		}
+		entry := IPPEntry{CommonName: fields[0], VirtualAddress: fields[1]}
+		if len(fields) > 2 {
+			entry.VirtualIPv6 = fields[2]
+		}
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
+
+func NewIPPExporter(sources []IPPSource, exportClients bool) (*IPPExporter, error) {
+	for _, source := range sources {
+		if source.Pool.Step == 0 {
+			return nil, fmt.Errorf("no address pool configured for %s", source.Path)
+		}
+	}
+	return &IPPExporter{
+		sources:       sources,
+		exportClients: exportClients,
+		ippUpDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("openvpn", "ipp", "up"),
+			"Whether reading the ifconfig-pool-persist file was successful.",
+			[]string{"path"}, nil),
+		ippPoolSizeDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("openvpn", "ipp", "pool_size_addresses"),
+			"Number of client addresses in the configured pool.",
+			[]string{"path", "pool"}, nil),
+		ippPoolAssignedDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("openvpn", "ipp", "pool_assigned_addresses"),
+			"Number of client addresses in the pool that are persisted to a common name.",
+			[]string{"path", "pool"}, nil),
+		ippPoolFreeDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("openvpn", "ipp", "pool_free_addresses"),
+			"Number of client addresses in the pool that are not persisted to a common name.",
+			[]string{"path", "pool"}, nil),
+		ippClientInfoDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("openvpn", "ipp", "client_info"),
+			"Address persisted for a common name, joinable with route metrics on common_name and virtual_address.",
+			[]string{"path", "common_name", "virtual_address"}, nil),
+	}, nil
+}
+
+func (e *IPPExporter) collectIPP(source IPPSource, ch chan<- prometheus.Metric) error {
+	file, err := os.Open(source.Path)
+	if err != nil {
+		return fmt.Errorf("failed to open ifconfig-pool-persist file %s: %s", source.Path, err)
+	}
+	defer file.Close()
+	entries, err := parseIPP(file)
+	if err != nil {
+		return fmt.Errorf("failed to parse ifconfig-pool-persist file %s: %s", source.Path, err)
+	}
+
+	assigned := map[int]bool{}
+	recorded := map[IPPEntry]bool{}
+	for _, entry := range entries {
+		addr, err := netip.ParseAddr(entry.VirtualAddress)
+		if err != nil {
+			slog.Warn("Invalid address in ifconfig-pool-persist file", "path", source.Path, "common_name", entry.CommonName, "virtual_address", entry.VirtualAddress)
+			continue
+		}
+		if slot, ok := source.Pool.Slot(addr); ok {
+			assigned[slot] = true
+		}
+		if e.exportClients && !recorded[entry] {
+			recorded[entry] = true
+			if err := sendMetric(ch,
+				e.ippClientInfoDesc,
+				prometheus.GaugeValue,
+				1.0,
+				source.Path,
+				entry.CommonName,
+				entry.VirtualAddress); err != nil {
+				return err
+			}
+		}
+	}
+
+	pool := source.Pool.String()
+	size := source.Pool.Size()
+	if err := sendMetric(ch,
+		e.ippPoolSizeDesc,
+		prometheus.GaugeValue,
+		float64(size),
+		source.Path,
+		pool); err != nil {
+		return err
+	}
+	if err := sendMetric(ch,
+		e.ippPoolAssignedDesc,
+		prometheus.GaugeValue,
+		float64(len(assigned)),
+		source.Path,
+		pool); err != nil {
+		return err
+	}
+	if err := sendMetric(ch,
+		e.ippPoolFreeDesc,
+		prometheus.GaugeValue,
+		float64(size-len(assigned)),
+		source.Path,
+		pool); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (e *IPPExporter) Describe(ch chan<- *prometheus.Desc) {
+	ch <- e.ippUpDesc
+	ch <- e.ippPoolSizeDesc
+	ch <- e.ippPoolAssignedDesc
+	ch <- e.ippPoolFreeDesc
+	ch <- e.ippClientInfoDesc
+}
+
+func (e *IPPExporter) Collect(ch chan<- prometheus.Metric) {
+	for _, source := range e.sources {
+		up := 1.0
+		if err := e.collectIPP(source, ch); err != nil {
+			slog.Warn("Failed to read ifconfig-pool-persist file", "path", source.Path, "err", err)
+			up = 0.0
+		}
+		ch <- prometheus.MustNewConstMetric(
+			e.ippUpDesc,
+			prometheus.GaugeValue,
+			up,
+			source.Path)
+	}
+}
@@ -0,0 +1,89 @@
+package exporters
+
+import (
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestParseIPPool(t *testing.T) {
+	tests := []struct {
+		pool     string
+		topology string
+		want     string
+		size     int
+	}{
+		{"10.8.0.0/24", "subnet", "10.8.0.2-10.8.0.253", 252},
+		{"10.8.0.0/24", "net30", "10.8.0.4-10.8.0.251", 62},
+		{"10.8.0.0/24", "p2p", "10.8.0.4-10.8.0.251", 248},
+		{"10.8.0.0/29", "subnet", "10.8.0.2-10.8.0.5", 4},
+		{"10.8.0.0/28", "net30", "10.8.0.4-10.8.0.11", 2},
+		{"10.8.0.0/28", "p2p", "10.8.0.4-10.8.0.11", 8},
+		{"10.8.0.10-10.8.0.19", "p2p", "10.8.0.10-10.8.0.19", 10},
+	}
+	for _, test := range tests {
+		pool, err := ParseIPPool(test.pool, test.topology)
+		if err != nil {
+			t.Errorf("%s: %s", test.pool, err)
+			continue
+		}
+		if pool.String() != test.want || pool.Size() != test.size {
+			t.Errorf("%s: expected %s with %d addresses, got %s with %d", test.pool, test.want, test.size, pool, pool.Size())
+		}
+	}
+
+	for _, pool := range []string{"10.8.0.0/30", "fd00::/64", "10.8.0.20-10.8.0.10"} {
+		if _, err := ParseIPPool(pool, "subnet"); err == nil {
+			t.Errorf("%s: expected error", pool)
+		}
+	}
+	if _, err := ParseIPPool("10.8.0.0/29", "net30"); err == nil {
+		t.Error("expected error for net30 network without room for a pool")
+	}
+	if _, err := ParseIPPool("10.8.0.0/24", "bridge"); err == nil {
+		t.Error("expected error for unsupported topology")
+	}
+}
+
+func TestIPPExporterCollect(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ipp.txt")
+	ipp := "client1,10.8.0.4,\nclient2,10.8.0.8,fd00::1000\nclient3,10.8.0.10\nclient4,192.168.1.1\n"
+	if err := os.WriteFile(path, []byte(ipp), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	pool, err := ParseIPPool("10.8.0.0/24", "net30")
+	if err != nil {
+		t.Fatal(err)
+	}
+	exporter, err := NewIPPExporter([]IPPSource{{Path: path, Pool: pool}}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// client2 and client3 share a net30 subnet, and client4 is outside
+	// of the pool.
+	expected := `
+# HELP openvpn_ipp_pool_assigned_addresses Number of client addresses in the pool that are persisted to a common name.
+# TYPE openvpn_ipp_pool_assigned_addresses gauge
+openvpn_ipp_pool_assigned_addresses{path="PATH",pool="10.8.0.4-10.8.0.251"} 2
+# HELP openvpn_ipp_pool_free_addresses Number of client addresses in the pool that are not persisted to a common name.
+# TYPE openvpn_ipp_pool_free_addresses gauge
+openvpn_ipp_pool_free_addresses{path="PATH",pool="10.8.0.4-10.8.0.251"} 60
+`
+	if err := testutil.CollectAndCompare(exporter, strings.NewReader(strings.ReplaceAll(expected, "PATH", path)),
+		"openvpn_ipp_pool_assigned_addresses",
+		"openvpn_ipp_pool_free_addresses"); err != nil {
+		t.Error(err)
+	}
+	if count := testutil.CollectAndCount(exporter, "openvpn_ipp_client_info"); count != 4 {
+		t.Errorf("expected 4 client info metrics, got %d", count)
+	}
+
+	if _, ok := pool.Slot(netip.MustParseAddr("10.8.0.252")); ok {
+		t.Error("expected address past the end of the pool to have no slot")
+	}
+}
@@ -13,9 +13,9 @@ func getLabels(ignoreIndividuals bool, version string) ([]string, []string, []st
 			serverHeaderRoutingLabels = []string{"status_path", "common_name"}
 			serverHeaderRoutingLabelColumns = []string{"Common Name"}
 		} else {
-			serverHeaderClientLabels = []string{"status_path", "common_name", "connection_time", "real_address", "virtual_address", "username"}
+			serverHeaderClientLabels = []string{"status_path", "common_name", "connection_time", "proto", "real_ip", "real_port", "virtual_address", "username"}
 			serverHeaderClientLabelColumns = []string{"Common Name", "Connected Since (time_t)", "Real Address", "Virtual Address", "Username"}
-			serverHeaderRoutingLabels = []string{"status_path", "common_name", "real_address", "virtual_address"}
+			serverHeaderRoutingLabels = []string{"status_path", "common_name", "proto", "real_ip", "real_port", "virtual_address"}
 			serverHeaderRoutingLabelColumns = []string{"Common Name", "Real Address", "Virtual Address"}
 		}
 	}
@@ -27,9 +27,9 @@ func getLabels(ignoreIndividuals bool, version string) ([]string, []string, []st
 			serverHeaderRoutingLabels = []string{"status_path", "common_name"}
 			serverHeaderRoutingLabelColumns = []string{"Common Name"}
 		} else {
-			serverHeaderClientLabels = []string{"status_path", "common_name", "connection_time", "real_address"}
+			serverHeaderClientLabels = []string{"status_path", "common_name", "connection_time", "proto", "real_ip", "real_port"}
 			serverHeaderClientLabelColumns = []string{"Common Name", "Connected Since", "Real Address"}
-			serverHeaderRoutingLabels = []string{"status_path", "common_name", "real_address", "virtual_address"}
+			serverHeaderRoutingLabels = []string{"status_path", "common_name", "proto", "real_ip", "real_port", "virtual_address"}
 			serverHeaderRoutingLabelColumns = []string{"Common Name", "Real Address", "Virtual Address"}
 		}
 	}
@@ -0,0 +1,285 @@
+package exporters
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	logEventTLSError = iota
+	logEventAuthFailure
+	logEventRestart
+)
+
+// Log lines that are counted, tried in order. The first match wins, so
+// the more specific patterns come first. Servers log the reason for an
+// authentication failure before sending AUTH_FAILED, so only clients
+// count the latter.
+var logPatterns = []struct {
+	re     *regexp.Regexp
+	event  int
+	reason string
+}{
+	{regexp.MustCompile(`Received control message: '?AUTH_FAILED`), logEventAuthFailure, "auth_failed"},
+	{regexp.MustCompile(`Auth Username/Password verification failed`), logEventAuthFailure, "user_pass"},
+	{regexp.MustCompile(`VERIFY ERROR: .*certificate has expired`), logEventAuthFailure, "certificate_expired"},
+	{regexp.MustCompile(`VERIFY ERROR: .*certificate revoked|CRL CHECK FAILED`), logEventAuthFailure, "certificate_revoked"},
+	{regexp.MustCompile(`VERIFY ERROR`), logEventAuthFailure, "certificate"},
+	{regexp.MustCompile(`TLS Auth Error`), logEventAuthFailure, "other"},
+	{regexp.MustCompile(`packet HMAC authentication failed|cannot locate HMAC in incoming packet`), logEventAuthFailure, "hmac"},
+	// Failed handshakes log several TLS errors describing the cause, but
+	// always end with this one.
+	{regexp.MustCompile(`TLS Error: TLS handshake failed`), logEventTLSError, ""},
+	// Restarts that pause before reconnecting also log "Restart pause",
+	// which is not counted separately.
+	{regexp.MustCompile(`received, process restarting`), logEventRestart, ""},
+}
+
+// Follows a log file in the way tail -F does, detecting both rotation
+// (the path referring to a different file) and truncation.
+type logTail struct {
+	path    string
+	file    *os.File
+	reader  *bufio.Reader
+	offset  int64
+	partial string
+}
+
+func (t *logTail) open(fromEnd bool) error {
+	file, err := os.Open(t.path)
+	if err != nil {
+		return err
+	}
+	offset := int64(0)
+	if fromEnd {
+		if offset, err = file.Seek(0, io.SeekEnd); err != nil {
+			file.Close()
+			return err
+		}
+	}
+	t.file = file
+	t.reader = bufio.NewReader(file)
+	t.offset = offset
+	t.partial = ""
+	return nil
+}
+
+func (t *logTail) close() {
+	if t.file != nil {
+		t.file.Close()
+		t.file = nil
+	}
+}
+
+// Reads all complete lines that have been appended since the last call.
+func (t *logTail) readLines(handle func(string)) error {
+	for {
+		chunk, err := t.reader.ReadString('\n')
+		t.offset += int64(len(chunk))
+		if err != nil {
+			// Keep incomplete lines until the rest has been written.
+			t.partial += chunk
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		line := t.partial + chunk
+		t.partial = ""
+		handle(line)
+	}
+}
+
+// Passes on the incomplete line at the end of a file that has been rotated
+// or truncated. It is never finished, as OpenVPN continues in a new file
+// or, when truncating, has restarted.
+func (t *logTail) flushPartial(handle func(string)) {
+	if t.partial != "" {
+		handle(t.partial)
+		t.partial = ""
+	}
+}
+
+func (t *logTail) poll(handle func(string)) error {
+	if t.file == nil {
+		// The file did not exist yet, so it is read from the start once
+		// it appears.
+		if err := t.open(false); err != nil {
+			return err
+		}
+	}
+	if err := t.readLines(handle); err != nil {
+		return err
+	}
+
+	current, err := t.file.Stat()
+	if err != nil {
+		return err
+	}
+	latest, err := os.Stat(t.path)
+	if err != nil {
+		// The file may be absent briefly while being rotated.
+		return nil
+	}
+	if !os.SameFile(current, latest) {
+		// Rotated. The remainder of the old file was read above.
+		t.flushPartial(handle)
+		t.close()
+		if err := t.open(false); err != nil {
+			return err
+		}
+		return t.readLines(handle)
+	}
+	if latest.Size() < t.offset {
+		// Truncated, e.g. by OpenVPN restarting without --log-append.
+		if _, err := t.file.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		t.flushPartial(handle)
+		t.reader.Reset(t.file)
+		t.offset = 0
+		return t.readLines(handle)
+	}
+	return nil
+}
+
+type LogExporter struct {
+	paths        []string
+	pollInterval time.Duration
+
+	logLinesTotal        *prometheus.CounterVec
+	logTLSErrorsTotal    *prometheus.CounterVec
+	logAuthFailuresTotal *prometheus.CounterVec
+	logRestartsTotal     *prometheus.CounterVec
+}
+
+func NewLogExporter(paths []string, pollInterval time.Duration) (*LogExporter, error) {
+	if pollInterval <= 0 {
+		return nil, fmt.Errorf("log poll interval must be positive, got %s", pollInterval)
+	}
+	e := &LogExporter{
+		paths:        paths,
+		pollInterval: pollInterval,
+		logLinesTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "openvpn",
+			Subsystem: "log",
+			Name:      "lines_total",
+			Help:      "Number of lines read from the OpenVPN log file.",
+		}, []string{"log_path"}),
+		logTLSErrorsTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "openvpn",
+			Subsystem: "log",
+			Name:      "tls_errors_total",
+			Help:      "Number of failed TLS handshakes logged by OpenVPN.",
+		}, []string{"log_path"}),
+		logAuthFailuresTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "openvpn",
+			Subsystem: "log",
+			Name:      "auth_failures_total",
+			Help:      "Number of authentication failures logged by OpenVPN, by reason.",
+		}, []string{"log_path", "reason"}),
+		logRestartsTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "openvpn",
+			Subsystem: "log",
+			Name:      "restarts_total",
+			Help:      "Number of restarts logged by OpenVPN.",
+		}, []string{"log_path"}),
+	}
+	for _, path := range paths {
+		// Initialize the counters, so they are exported before the first
+		// matching line.
+		e.logLinesTotal.WithLabelValues(path)
+		e.logTLSErrorsTotal.WithLabelValues(path)
+		e.logRestartsTotal.WithLabelValues(path)
+		for _, pattern := range logPatterns {
+			if pattern.event == logEventAuthFailure {
+				e.logAuthFailuresTotal.WithLabelValues(path, pattern.reason)
+			}
+		}
+	}
+	return e, nil
+}
+
+func (e *LogExporter) handleLine(path string, line string) {
+	e.logLinesTotal.WithLabelValues(path).Inc()
+	for _, pattern := range logPatterns {
+		if !pattern.re.MatchString(line) {
+			continue
+		}
+		switch pattern.event {
+		case logEventTLSError:
+			e.logTLSErrorsTotal.WithLabelValues(path).Inc()
+		case logEventAuthFailure:
+			e.logAuthFailuresTotal.WithLabelValues(path, pattern.reason).Inc()
+		case logEventRestart:
+			e.logRestartsTotal.WithLabelValues(path).Inc()
+		}
+		return
+	}
+}
+
+// Follows all log files until the context is cancelled. Only lines written
+// after the exporter started are counted.
+func (e *LogExporter) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, path := range e.paths {
+		wg.Add(1)
+		go func(path string) {
+			defer wg.Done()
+			e.follow(ctx, path)
+		}(path)
+	}
+	wg.Wait()
+}
+
+func (e *LogExporter) follow(ctx context.Context, path string) {
+	tail := &logTail{path: path}
+	if err := tail.open(true); err != nil {
+		slog.Warn("Failed to open log file, waiting for it to appear", "log_path", path, "err", err)
+	}
+	defer tail.close()
+
+	ticker := time.NewTicker(e.pollInterval)
+	defer ticker.Stop()
+	lastErr := ""
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		err := tail.poll(func(line string) { e.handleLine(path, line) })
+		if err != nil && err.Error() != lastErr {
+			slog.Warn("Failed to read log file", "log_path", path, "err", err)
+		}
+		if err != nil {
+			lastErr = err.Error()
+		} else {
+			lastErr = ""
+		}
+	}
+}
+
+func (e *LogExporter) Describe(ch chan<- *prometheus.Desc) {
+	e.logLinesTotal.Describe(ch)
+	e.logTLSErrorsTotal.Describe(ch)
+	e.logAuthFailuresTotal.Describe(ch)
+	e.logRestartsTotal.Describe(ch)
+}
+
+func (e *LogExporter) Collect(ch chan<- prometheus.Metric) {
+	e.logLinesTotal.Collect(ch)
+	e.logTLSErrorsTotal.Collect(ch)
+	e.logAuthFailuresTotal.Collect(ch)
+	e.logRestartsTotal.Collect(ch)
+}
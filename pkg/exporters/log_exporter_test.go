@@ -0,0 +1,130 @@
+package exporters
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func appendToFile(t *testing.T, path string, data string) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if _, err := file.WriteString(data); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLogExporterFollow(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "openvpn.log")
+	appendToFile(t, path, "2024-09-18 10:00:00 TLS Error: TLS handshake failed\n")
+
+	exporter, err := NewLogExporter([]string{path}, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tail := &logTail{path: path}
+	if err := tail.open(true); err != nil {
+		t.Fatal(err)
+	}
+	defer tail.close()
+	poll := func() {
+		if err := tail.poll(func(line string) { exporter.handleLine(path, line) }); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Lines written before the exporter started are not counted, and
+	// incomplete lines are only counted once finished.
+	appendToFile(t, path, "2024-09-18 10:00:01 client1/1.2.3.4:1194 TLS Error: TLS key negotiation failed to occur within 60 seconds (check your network connectivity)\n")
+	appendToFile(t, path, "2024-09-18 10:00:01 client1/1.2.3.4:1194 TLS Error: TLS handshake failed\n")
+	appendToFile(t, path, "2024-09-18 10:00:02 1.2.3.4:1194 TLS Auth Error: Auth Username/Password verification")
+	poll()
+	appendToFile(t, path, " failed for peer\n")
+	poll()
+
+	// Rotation, with lines written to the old file just before, the last
+	// of which is never finished.
+	appendToFile(t, path, "2024-09-18 10:00:03 Restart pause, 5 second(s)\n")
+	appendToFile(t, path, "2024-09-18 10:00:03 SIGUSR1[soft,ping-restart] received, process restarting")
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatal(err)
+	}
+	appendToFile(t, path, "2024-09-18 10:00:04 VERIFY ERROR: depth=0, error=certificate has expired: CN=client2\n")
+	poll()
+
+	// Truncation, with an unfinished line written just before.
+	appendToFile(t, path, "2024-09-18 10:00:05 1.2.3.4:1194 Auth Username/Password verification failed for peer")
+	poll()
+	if err := os.WriteFile(path, []byte("2024-09-18 10:00:05 AUTH: Received control message: AUTH_FAILED\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	poll()
+
+	for _, test := range []struct {
+		name     string
+		got      float64
+		expected float64
+	}{
+		{"lines", testutil.ToFloat64(exporter.logLinesTotal.WithLabelValues(path)), 8},
+		{"tls errors", testutil.ToFloat64(exporter.logTLSErrorsTotal.WithLabelValues(path)), 1},
+		{"restarts", testutil.ToFloat64(exporter.logRestartsTotal.WithLabelValues(path)), 1},
+		{"user_pass", testutil.ToFloat64(exporter.logAuthFailuresTotal.WithLabelValues(path, "user_pass")), 2},
+		{"certificate_expired", testutil.ToFloat64(exporter.logAuthFailuresTotal.WithLabelValues(path, "certificate_expired")), 1},
+		{"auth_failed", testutil.ToFloat64(exporter.logAuthFailuresTotal.WithLabelValues(path, "auth_failed")), 1},
+		{"hmac", testutil.ToFloat64(exporter.logAuthFailuresTotal.WithLabelValues(path, "hmac")), 0},
+	} {
+		if test.got != test.expected {
+			t.Errorf("%s: expected %v, got %v", test.name, test.expected, test.got)
+		}
+	}
+}
+
+// Every TLS failure logs several lines, of which only one is counted.
+func TestLogExporterTLSErrors(t *testing.T) {
+	const log = `2024-09-18 10:00:01 1.2.3.4:51234 TLS Error: TLS key negotiation failed to occur within 60 seconds (check your network connectivity)
+2024-09-18 10:00:01 1.2.3.4:51234 TLS Error: TLS handshake failed
+2024-09-18 10:00:02 1.2.3.4:51235 VERIFY ERROR: depth=0, error=certificate has expired: CN=client2, serial=2
+2024-09-18 10:00:02 1.2.3.4:51235 OpenSSL: error:0A000086:SSL routines::certificate verify failed
+2024-09-18 10:00:02 1.2.3.4:51235 TLS_ERROR: BIO read tls_read_plaintext error
+2024-09-18 10:00:02 1.2.3.4:51235 TLS Error: TLS object -> incoming plaintext read error
+2024-09-18 10:00:02 1.2.3.4:51235 TLS Error: TLS handshake failed
+2024-09-18 10:00:03 TLS Error: cannot locate HMAC in incoming packet from [AF_INET]1.2.3.4:51236
+`
+	path := "openvpn.log"
+	exporter, err := NewLogExporter([]string{path}, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range strings.SplitAfter(strings.TrimSuffix(log, "\n"), "\n") {
+		exporter.handleLine(path, line)
+	}
+
+	for _, test := range []struct {
+		name     string
+		got      float64
+		expected float64
+	}{
+		{"tls errors", testutil.ToFloat64(exporter.logTLSErrorsTotal.WithLabelValues(path)), 2},
+		{"certificate_expired", testutil.ToFloat64(exporter.logAuthFailuresTotal.WithLabelValues(path, "certificate_expired")), 1},
+		{"hmac", testutil.ToFloat64(exporter.logAuthFailuresTotal.WithLabelValues(path, "hmac")), 1},
+	} {
+		if test.got != test.expected {
+			t.Errorf("%s: expected %v, got %v", test.name, test.expected, test.got)
+		}
+	}
+}
+
+func TestLogExporterPollInterval(t *testing.T) {
+	for _, interval := range []time.Duration{0, -time.Second} {
+		if _, err := NewLogExporter([]string{"openvpn.log"}, interval); err == nil {
+			t.Errorf("expected error for poll interval %s", interval)
+		}
+	}
+}
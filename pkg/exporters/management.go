@@ -0,0 +1,164 @@
+package exporters
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const managementTimeout = 10 * time.Second
+
+// Reports whether a status path refers to an OpenVPN management interface,
+// given as unix:///path/to/socket or tcp://host:port. A file containing
+// the management password can be passed as the password_file parameter.
+func isManagementAddress(statusPath string) bool {
+	return strings.HasPrefix(statusPath, "unix://") || strings.HasPrefix(statusPath, "tcp://")
+}
+
+// Connects to an OpenVPN management interface, logging in with the
+// password from the given file or else from the password_file parameter,
+// if any.
+func dialManagement(statusPath string, passwordFile string) (net.Conn, *bufio.Reader, error) {
+	address, err := url.Parse(statusPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid management address %s: %s", statusPath, err)
+	}
+	var conn net.Conn
+	switch address.Scheme {
+	case "unix":
+		conn, err = net.DialTimeout("unix", address.Path, managementTimeout)
+	case "tcp":
+		conn, err = net.DialTimeout("tcp", address.Host, managementTimeout)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to connect to management interface %s: %s", statusPath, err)
+	}
+	if err := conn.SetDeadline(time.Now().Add(managementTimeout)); err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+
+	reader := bufio.NewReader(conn)
+	if passwordFile == "" {
+		passwordFile = address.Query().Get("password_file")
+	}
+	if passwordFile != "" {
+		if err := sendManagementPassword(conn, reader, passwordFile); err != nil {
+			conn.Close()
+			return nil, nil, err
+		}
+	}
+	return conn, reader, nil
+}
+
+func sendManagementPassword(conn net.Conn, reader *bufio.Reader, passwordFile string) error {
+	password, err := os.ReadFile(passwordFile)
+	if err != nil {
+		return fmt.Errorf("failed to read management password: %s", err)
+	}
+	// The password prompt is not terminated by a newline.
+	prompt := make([]byte, len("ENTER PASSWORD:"))
+	if _, err := io.ReadFull(reader, prompt); err != nil {
+		return err
+	}
+	if !bytes.Equal(prompt, []byte("ENTER PASSWORD:")) {
+		return fmt.Errorf("management interface did not ask for a password")
+	}
+	firstLine, _, _ := bytes.Cut(password, []byte("\n"))
+	_, err = fmt.Fprintf(conn, "%s\n", bytes.TrimSpace(firstLine))
+	return err
+}
+
+// Sends a command to a management interface, returning its response up to
+// and including the END line.
+func managementCommand(conn net.Conn, reader *bufio.Reader, command string) ([]byte, error) {
+	if _, err := fmt.Fprintf(conn, "%s\n", command); err != nil {
+		return nil, err
+	}
+
+	var response bytes.Buffer
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s from management interface: %s", command, err)
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if strings.HasPrefix(line, ">") || strings.HasPrefix(line, "SUCCESS:") {
+			// Real-time notifications and the password confirmation.
+			continue
+		} else if strings.HasPrefix(line, "ERROR:") {
+			return nil, fmt.Errorf("management interface returned %q", line)
+		}
+		response.WriteString(line)
+		response.WriteString("\n")
+		if line == "END" {
+			return response.Bytes(), nil
+		}
+	}
+}
+
+// Obtains status information in the version 3 format over the OpenVPN
+// management interface. Statuses of OpenVPN clients lack the TITLE line
+// describing the build of servers, so the response to the version command
+// is returned along with them.
+func readManagementStatus(statusPath string, passwordFile string) ([]byte, []byte, error) {
+	conn, reader, err := dialManagement(statusPath, passwordFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer conn.Close()
+	status, err := managementCommand(conn, reader, "status 3")
+	if err != nil {
+		return nil, nil, err
+	}
+	var version []byte
+	if !bytes.HasPrefix(status, []byte("TITLE")) {
+		if version, err = managementCommand(conn, reader, "version"); err != nil {
+			slog.Warn("Failed to read version from management interface", "status_path", statusPath, "err", err)
+		}
+	}
+	_, _ = fmt.Fprint(conn, "quit\n")
+	return status, version, nil
+}
+
+// Returns the build of OpenVPN from the response of the version command,
+// which describes it like the TITLE line of a status. Only the OpenVPN
+// Version line is used, as other lines, e.g. Management Version, describe
+// other parts of the build.
+func parseManagementVersion(response []byte) (string, bool) {
+	for _, line := range strings.Split(string(response), "\n") {
+		if line == "END" {
+			break
+		}
+		key, value, ok := strings.Cut(line, ": ")
+		if ok && key == "OpenVPN Version" && strings.HasPrefix(value, "OpenVPN ") {
+			return value, true
+		}
+	}
+	return "", false
+}
+
+// Exports the status read over a management interface, along with the
+// build of OpenVPN if the status lacks the TITLE line.
+func (e *OpenVPNExporter) collectStatusFromManagement(statusPath string, ch chan<- prometheus.Metric) error {
+	status, version, err := readManagementStatus(statusPath, e.passwordFiles[statusPath])
+	if err != nil {
+		return err
+	}
+	if err := e.collectStatusFromReader(statusPath, bytes.NewReader(status), ch); err != nil {
+		return err
+	}
+	if title, ok := parseManagementVersion(version); ok {
+		return e.collectTitle(statusPath, title, ch)
+	}
+	return nil
+}
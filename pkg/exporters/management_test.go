@@ -0,0 +1,164 @@
+package exporters
+
+import (
+	"bufio"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// Serves a single management interface session that requires a password
+// and answers the given commands, returning the commands received.
+func serveManagement(t *testing.T, listener net.Listener, password string, responses map[string]string) []string {
+	conn, err := listener.Accept()
+	if err != nil {
+		t.Error(err)
+		return nil
+	}
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	// The prompt is written in parts, so that it cannot be read at once.
+	conn.Write([]byte("ENTER "))
+	time.Sleep(10 * time.Millisecond)
+	conn.Write([]byte("PASSWORD:"))
+	if line, _ := reader.ReadString('\n'); strings.TrimSpace(line) != password {
+		conn.Write([]byte("ERROR: bad password\r\n"))
+		return nil
+	}
+	conn.Write([]byte("SUCCESS: password is correct\r\n>INFO:OpenVPN Management Interface Version 3 -- type 'help' for more info\r\n"))
+	var commands []string
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return commands
+		}
+		command := strings.TrimSpace(line)
+		commands = append(commands, command)
+		if command == "quit" {
+			return commands
+		}
+		response, ok := responses[command]
+		if !ok {
+			conn.Write([]byte("ERROR: unknown command\r\n"))
+			continue
+		}
+		conn.Write([]byte(strings.ReplaceAll(response, "\n", "\r\n")))
+	}
+}
+
+func TestReadManagementStatus(t *testing.T) {
+	dir := t.TempDir()
+	socketPath := filepath.Join(dir, "management.sock")
+	passwordPath := filepath.Join(dir, "management.pw")
+	if err := os.WriteFile(passwordPath, []byte("secret\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	status := "TITLE\tOpenVPN 2.6.12\nTIME\tTue Mar 21 10:39:14 2017\t1490089154\n>BYTECOUNT:1,2\nEND\n"
+	go serveManagement(t, listener, "secret", map[string]string{"status 3": status})
+
+	statusPath := "unix://" + socketPath + "?password_file=" + passwordPath
+	if !isManagementAddress(statusPath) {
+		t.Fatalf("expected %s to be a management address", statusPath)
+	}
+	result, _, err := readManagementStatus(statusPath, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "TITLE\tOpenVPN 2.6.12\nTIME\tTue Mar 21 10:39:14 2017\t1490089154\nEND\n"; string(result) != expected {
+		t.Errorf("expected %q, got %q", expected, result)
+	}
+}
+
+// The build of OpenVPN clients, whose statuses lack the TITLE line, is
+// read with the version command.
+func TestManagementVersion(t *testing.T) {
+	version := "OpenVPN Version: OpenVPN 2.6.12 x86_64-pc-linux-gnu [SSL (OpenSSL)] [LZO] [EPOLL] built on Jul 18 2024\r\n" +
+		">INFO:OpenVPN Management Interface Version 5 -- type 'help' for more info\r\n" +
+		"Management Version: 5\r\nEND\r\n"
+	for _, test := range []struct {
+		status   string
+		commands []string
+	}{
+		{
+			"OpenVPN STATISTICS\nUpdated,Tue Mar 21 10:39:09 2017\nTUN/TAP read bytes,153789941\nEND\n",
+			[]string{"status 3", "version", "quit"},
+		},
+		{
+			"TITLE\tOpenVPN 2.6.12 x86_64-pc-linux-gnu [SSL (OpenSSL)] [LZO] [EPOLL] built on Jul 18 2024\nTIME\tTue Mar 21 10:39:14 2017\t1490089154\nEND\n",
+			[]string{"status 3", "quit"},
+		},
+	} {
+		dir := t.TempDir()
+		socketPath := filepath.Join(dir, "management.sock")
+		passwordPath := filepath.Join(dir, "management.pw")
+		if err := os.WriteFile(passwordPath, []byte("secret\n"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		listener, err := net.Listen("unix", socketPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		commands := make(chan []string, 1)
+		go func() {
+			commands <- serveManagement(t, listener, "secret", map[string]string{"status 3": test.status, "version": version})
+		}()
+
+		statusPath := "unix://" + socketPath
+		e, err := NewOpenVPNExporter([]string{statusPath}, false, "2.3")
+		if err != nil {
+			t.Fatal(err)
+		}
+		e.SetPasswordFile(statusPath, passwordPath)
+		expected := `# HELP openvpn_server_info Version, platform and SSL library of the OpenVPN build, from the TITLE line of its status or its management interface.
+# TYPE openvpn_server_info gauge
+openvpn_server_info{platform="x86_64-pc-linux-gnu",ssl_library="OpenSSL",status_path="` + statusPath + `",version="2.6.12"} 1
+`
+		if err := testutil.CollectAndCompare(e, strings.NewReader(expected), "openvpn_server_info"); err != nil {
+			t.Error(err)
+		}
+		if received := <-commands; !slices.Equal(received, test.commands) {
+			t.Errorf("expected commands %q, got %q", test.commands, received)
+		}
+		listener.Close()
+	}
+}
+
+func TestParseManagementVersion(t *testing.T) {
+	for _, test := range []struct {
+		response string
+		title    string
+		ok       bool
+	}{
+		{
+			"OpenVPN Version: OpenVPN 2.6.12 x86_64-pc-linux-gnu [SSL (OpenSSL)] [LZO] [LZ4] [EPOLL] [PKCS11] [MH/PKTINFO] [AEAD] [DCO] built on Jul 18 2024\n" +
+				"Management Version: 5\nEND\n",
+			"OpenVPN 2.6.12 x86_64-pc-linux-gnu [SSL (OpenSSL)] [LZO] [LZ4] [EPOLL] [PKCS11] [MH/PKTINFO] [AEAD] [DCO] built on Jul 18 2024",
+			true,
+		},
+		{
+			"Management Version: 5\nOpenVPN Version: OpenVPN 2.4.7 x86_64-pc-linux-gnu [SSL (OpenSSL)] [LZO] [LZ4] [EPOLL] [PKCS11] [MH/PKTINFO] [AEAD] built on Feb 20 2019\nEND\n",
+			"OpenVPN 2.4.7 x86_64-pc-linux-gnu [SSL (OpenSSL)] [LZO] [LZ4] [EPOLL] [PKCS11] [MH/PKTINFO] [AEAD] built on Feb 20 2019",
+			true,
+		},
+		{"Management Version: 5\nEND\n", "", false},
+		{"Management Version: OpenVPN Version: OpenVPN 2.6.12\nEND\n", "", false},
+		{"END\nOpenVPN Version: OpenVPN 2.6.12\n", "", false},
+		{"", "", false},
+	} {
+		title, ok := parseManagementVersion([]byte(test.response))
+		if title != test.title || ok != test.ok {
+			t.Errorf("%q: expected %q, %t, got %q, %t", test.response, test.title, test.ok, title, ok)
+		}
+	}
+}
@@ -3,10 +3,14 @@ package exporters
 import (
 	"bufio"
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"os"
+	"sync"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 )
@@ -22,13 +26,52 @@ type OpenvpnServerHeaderField struct {
 	ValueType prometheus.ValueType
 }
 
+// Metrics read from a status path at a point in time, or the error that
+// occurred reading them.
+type statusSnapshot struct {
+	metrics []prometheus.Metric
+	err     error
+	time    time.Time
+}
+
 type OpenVPNExporter struct {
-	statusPaths                 []string
+	statusPaths     []string
+	duplicatePolicy string
+	ignoreRealPort  bool
+	// Time zones in which statuses print dates, if not that of the host.
+	locations map[string]*time.Location
+	// Files containing the passwords of management interfaces, kept apart
+	// from their status paths so that they do not end up in labels.
+	passwordFiles map[string]string
+
+	mu sync.Mutex
+	// Snapshots are served instead of reading the status again while they
+	// are younger than the minimum refresh interval of their path, or at
+	// all times while the status is polled in the background.
+	snapshots           map[string]*statusSnapshot
+	minRefreshIntervals map[string]time.Duration
+	polling             bool
+	// Paths whose status has been read successfully at least once.
+	ready map[string]bool
+
 	openvpnUpDesc               *prometheus.Desc
+	openvpnSnapshotAgeDesc      *prometheus.Desc
+	openvpnStatusErrors         *prometheus.CounterVec
+	openvpnIncompleteReads      *prometheus.CounterVec
 	openvpnStatusUpdateTimeDesc *prometheus.Desc
 	openvpnConnectedClientsDesc *prometheus.Desc
-	openvpnClientDescs          map[string]*prometheus.Desc
-	openvpnServerHeaders        map[string]OpenvpnServerHeader
+	openvpnClientsByProtoDesc   *prometheus.Desc
+	openvpnRoutesDesc           *prometheus.Desc
+	openvpnRoutedSubnetDesc     *prometheus.Desc
+	// Inconsistencies between the client list and routing table.
+	openvpnOrphanRoutesDesc        *prometheus.Desc
+	openvpnClientsWithoutRouteDesc *prometheus.Desc
+	openvpnAddressConflictsDesc    *prometheus.Desc
+	openvpnDuplicateSessionsDesc   *prometheus.Desc
+	openvpnServerInfoDesc          *prometheus.Desc
+	openvpnServerFeatureDesc       *prometheus.Desc
+	openvpnClientDescs             map[string]*prometheus.Desc
+	openvpnServerHeaders           map[string]OpenvpnServerHeader
 }
 
 func NewOpenVPNExporter(statusPaths []string, ignoreIndividuals bool, version string) (*OpenVPNExporter, error) {
@@ -41,12 +84,65 @@ func NewOpenVPNExporter(statusPaths []string, ignoreIndividuals bool, version st
 		prometheus.BuildFQName("openvpn", "", "status_update_time_seconds"),
 		"UNIX timestamp at which the OpenVPN statistics were updated.",
 		[]string{"status_path"}, nil)
+	openvpnSnapshotAgeDesc := prometheus.NewDesc(
+		prometheus.BuildFQName("openvpn", "status", "snapshot_age_seconds"),
+		"Time since the exported OpenVPN statistics were read, in seconds.",
+		[]string{"status_path"}, nil)
+
+	openvpnStatusErrors := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: prometheus.BuildFQName("openvpn", "status", "errors_total"),
+		Help: "Number of times reading or parsing the OpenVPN statistics failed.",
+	}, []string{"status_path"})
+	openvpnIncompleteReads := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: prometheus.BuildFQName("openvpn", "status", "incomplete_reads_total"),
+		Help: "Number of times the OpenVPN statistics were read while being rewritten, lacking the END line.",
+	}, []string{"status_path"})
+	for _, statusPath := range statusPaths {
+		openvpnStatusErrors.WithLabelValues(sanitizeLabelValues([]string{statusPath})...)
+		openvpnIncompleteReads.WithLabelValues(sanitizeLabelValues([]string{statusPath})...)
+	}
 
 	// Metrics specific to OpenVPN servers.
 	openvpnConnectedClientsDesc := prometheus.NewDesc(
 		prometheus.BuildFQName("openvpn", "", "server_connected_clients"),
 		"Number Of Connected Clients",
 		[]string{"status_path"}, nil)
+	openvpnClientsByProtoDesc := prometheus.NewDesc(
+		prometheus.BuildFQName("openvpn", "", "server_connected_clients_by_proto"),
+		"Number of connected clients by transport protocol and address family.",
+		[]string{"status_path", "proto", "family"}, nil)
+	openvpnRoutesDesc := prometheus.NewDesc(
+		prometheus.BuildFQName("openvpn", "server", "routes"),
+		"Number of routing table entries by kind: host, subnet, mac or cached.",
+		[]string{"status_path", "kind"}, nil)
+	openvpnRoutedSubnetDesc := prometheus.NewDesc(
+		prometheus.BuildFQName("openvpn", "server", "client_routed_subnet_info"),
+		"Subnet routed to a client with --iroute.",
+		[]string{"status_path", "common_name", "subnet"}, nil)
+	openvpnOrphanRoutesDesc := prometheus.NewDesc(
+		prometheus.BuildFQName("openvpn", "server", "orphan_routes"),
+		"Number of routing table entries whose common name and real address are not in the client list.",
+		[]string{"status_path"}, nil)
+	openvpnClientsWithoutRouteDesc := prometheus.NewDesc(
+		prometheus.BuildFQName("openvpn", "server", "clients_without_route"),
+		"Number of connected clients without an entry in the routing table.",
+		[]string{"status_path"}, nil)
+	openvpnAddressConflictsDesc := prometheus.NewDesc(
+		prometheus.BuildFQName("openvpn", "server", "virtual_address_conflicts"),
+		"Number of virtual addresses held by more than one client.",
+		[]string{"status_path"}, nil)
+	openvpnDuplicateSessionsDesc := prometheus.NewDesc(
+		prometheus.BuildFQName("openvpn", "server", "duplicate_common_name_sessions"),
+		"Number of client sessions beyond the first of common names that are connected more than once.",
+		[]string{"status_path"}, nil)
+	openvpnServerInfoDesc := prometheus.NewDesc(
+		prometheus.BuildFQName("openvpn", "server", "info"),
+		"Version, platform and SSL library of the OpenVPN build, from the TITLE line of its status or its management interface.",
+		[]string{"status_path", "version", "platform", "ssl_library"}, nil)
+	openvpnServerFeatureDesc := prometheus.NewDesc(
+		prometheus.BuildFQName("openvpn", "server", "build_feature"),
+		"Features the OpenVPN build has, from the TITLE line of its status or its management interface.",
+		[]string{"status_path", "feature"}, nil)
 
 	// Metrics specific to OpenVPN clients.
 	openvpnClientDescs := map[string]*prometheus.Desc{
@@ -128,12 +224,30 @@ func NewOpenVPNExporter(statusPaths []string, ignoreIndividuals bool, version st
 	}
 
 	return &OpenVPNExporter{
-		statusPaths:                 statusPaths,
-		openvpnUpDesc:               openvpnUpDesc,
-		openvpnStatusUpdateTimeDesc: openvpnStatusUpdateTimeDesc,
-		openvpnConnectedClientsDesc: openvpnConnectedClientsDesc,
-		openvpnClientDescs:          openvpnClientDescs,
-		openvpnServerHeaders:        openvpnServerHeaders,
+		statusPaths:                    statusPaths,
+		snapshots:                      map[string]*statusSnapshot{},
+		ready:                          map[string]bool{},
+		minRefreshIntervals:            map[string]time.Duration{},
+		duplicatePolicy:                DuplicateFirst,
+		locations:                      map[string]*time.Location{},
+		passwordFiles:                  map[string]string{},
+		openvpnUpDesc:                  openvpnUpDesc,
+		openvpnSnapshotAgeDesc:         openvpnSnapshotAgeDesc,
+		openvpnStatusErrors:            openvpnStatusErrors,
+		openvpnIncompleteReads:         openvpnIncompleteReads,
+		openvpnStatusUpdateTimeDesc:    openvpnStatusUpdateTimeDesc,
+		openvpnConnectedClientsDesc:    openvpnConnectedClientsDesc,
+		openvpnClientsByProtoDesc:      openvpnClientsByProtoDesc,
+		openvpnRoutesDesc:              openvpnRoutesDesc,
+		openvpnRoutedSubnetDesc:        openvpnRoutedSubnetDesc,
+		openvpnOrphanRoutesDesc:        openvpnOrphanRoutesDesc,
+		openvpnClientsWithoutRouteDesc: openvpnClientsWithoutRouteDesc,
+		openvpnAddressConflictsDesc:    openvpnAddressConflictsDesc,
+		openvpnDuplicateSessionsDesc:   openvpnDuplicateSessionsDesc,
+		openvpnServerInfoDesc:          openvpnServerInfoDesc,
+		openvpnServerFeatureDesc:       openvpnServerFeatureDesc,
+		openvpnClientDescs:             openvpnClientDescs,
+		openvpnServerHeaders:           openvpnServerHeaders,
 	}, nil
 }
 
@@ -173,25 +287,240 @@ func (e *OpenVPNExporter) collectStatusFromFile(statusPath string, ch chan<- pro
 	return e.collectStatusFromReader(statusPath, conn, ch)
 }
 
+// Reads the status at a path, turning panics while doing so into errors,
+// so that a status that cannot be exported does not affect others.
+func (e *OpenVPNExporter) collectStatus(statusPath string, ch chan<- prometheus.Metric) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic while reading status: %v", r)
+		}
+	}()
+	if isManagementAddress(statusPath) {
+		return e.collectStatusFromManagement(statusPath, ch)
+	}
+	return e.collectStatusFromFile(statusPath, ch)
+}
+
+// Reads and parses the status at a path, returning the resulting metrics.
+func (e *OpenVPNExporter) collectSnapshot(statusPath string) *statusSnapshot {
+	snapshot := &statusSnapshot{time: time.Now()}
+	ch := make(chan prometheus.Metric)
+	done := make(chan struct{})
+	go func() {
+		for metric := range ch {
+			snapshot.metrics = append(snapshot.metrics, metric)
+		}
+		close(done)
+	}()
+	snapshot.err = e.collectStatus(statusPath, ch)
+	close(ch)
+	<-done
+	return snapshot
+}
+
+// Reads and parses the status at a path. Incomplete statuses are read
+// again a few times, after which the last complete snapshot is served, if
+// any.
+func (e *OpenVPNExporter) readSnapshot(statusPath string) *statusSnapshot {
+	label := sanitizeLabelValues([]string{statusPath})[0]
+	var snapshot *statusSnapshot
+	for attempt := 0; ; attempt++ {
+		snapshot = e.collectSnapshot(statusPath)
+		if !errors.Is(snapshot.err, errIncompleteStatus) {
+			break
+		}
+		e.openvpnIncompleteReads.WithLabelValues(label).Inc()
+		if attempt >= incompleteRetries {
+			e.mu.Lock()
+			previous, ok := e.snapshots[statusPath]
+			e.mu.Unlock()
+			if ok && previous.err == nil {
+				slog.Warn("Status is incomplete, serving the last complete one", "status_path", statusPath, "age", time.Since(previous.time))
+				return previous
+			}
+			break
+		}
+		time.Sleep(incompleteRetryDelay)
+	}
+	if snapshot.err != nil {
+		slog.Warn("Failed to read status", "status_path", statusPath, "err", snapshot.err)
+		e.openvpnStatusErrors.WithLabelValues(label).Inc()
+		snapshot.metrics = nil
+		return snapshot
+	}
+	e.mu.Lock()
+	e.ready[statusPath] = true
+	e.mu.Unlock()
+	return snapshot
+}
+
+// Returns the paths whose status has not been read successfully yet.
+func (e *OpenVPNExporter) Pending() []string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	var pending []string
+	for _, statusPath := range e.statusPaths {
+		if !e.ready[statusPath] {
+			pending = append(pending, statusPath)
+		}
+	}
+	return pending
+}
+
+// Reads the status of the paths that have not been read successfully yet,
+// as a scrape would, so that they can become ready before the first one.
+func (e *OpenVPNExporter) ReadPending() {
+	for _, statusPath := range e.Pending() {
+		e.snapshot(statusPath)
+	}
+}
+
+// Sets the minimum time between reads of the status at a path. Scrapes
+// within that time are served the metrics of the previous read, so that
+// frequent scrapes, e.g. by several Prometheus replicas, do not read the
+// status every time.
+func (e *OpenVPNExporter) SetMinRefreshInterval(statusPath string, interval time.Duration) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.minRefreshIntervals[statusPath] = interval
+}
+
+// Sets the time zone in which the status at a path prints dates, which
+// defaults to that of the host. Must be called before metrics are
+// collected.
+func (e *OpenVPNExporter) SetLocation(statusPath string, location *time.Location) {
+	e.locations[statusPath] = location
+}
+
+// Sets the file containing the password of the management interface at a
+// status path, taking precedence over its password_file parameter. Must be
+// called before metrics are collected.
+func (e *OpenVPNExporter) SetPasswordFile(statusPath string, passwordFile string) {
+	e.passwordFiles[statusPath] = passwordFile
+}
+
+// Sets whether the port of the real address of clients is left out of
+// their labels. Ports are ephemeral, so leaving them out reduces the
+// number of series. Must be called before metrics are collected.
+func (e *OpenVPNExporter) SetIgnoreRealPort(ignoreRealPort bool) {
+	e.ignoreRealPort = ignoreRealPort
+}
+
+// Sets how rows of a section with the same labels as a previous row are
+// exported: with the values of the first or last of them, or their sum or
+// maximum. Must be called before metrics are collected.
+func (e *OpenVPNExporter) SetDuplicatePolicy(policy string) error {
+	if !IsValidDuplicatePolicy(policy) {
+		return fmt.Errorf("unknown duplicate policy %q, supported policies are first, last, sum and max", policy)
+	}
+	e.duplicatePolicy = policy
+	return nil
+}
+
+// Returns the metrics of the status at a path, read now or earlier.
+func (e *OpenVPNExporter) snapshot(statusPath string) *statusSnapshot {
+	e.mu.Lock()
+	snapshot, ok := e.snapshots[statusPath]
+	if ok && (e.polling || time.Since(snapshot.time) < e.minRefreshIntervals[statusPath]) {
+		e.mu.Unlock()
+		return snapshot
+	}
+	e.mu.Unlock()
+
+	snapshot = e.readSnapshot(statusPath)
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if current, ok := e.snapshots[statusPath]; !ok || current.time.Before(snapshot.time) {
+		e.snapshots[statusPath] = snapshot
+	}
+	return snapshot
+}
+
+// Reads the status of every path in the background until the context is
+// cancelled, serving scrapes from the last read only. Every path is read
+// at the poll interval, or its minimum refresh interval if that is longer.
+func (e *OpenVPNExporter) Run(ctx context.Context, pollInterval time.Duration) {
+	e.mu.Lock()
+	e.polling = true
+	e.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, statusPath := range e.statusPaths {
+		interval := pollInterval
+		e.mu.Lock()
+		if e.minRefreshIntervals[statusPath] > interval {
+			interval = e.minRefreshIntervals[statusPath]
+		}
+		e.mu.Unlock()
+		wg.Add(1)
+		go func(statusPath string) {
+			defer wg.Done()
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+			for {
+				snapshot := e.readSnapshot(statusPath)
+				e.mu.Lock()
+				e.snapshots[statusPath] = snapshot
+				e.mu.Unlock()
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+				}
+			}
+		}(statusPath)
+	}
+	wg.Wait()
+}
+
 func (e *OpenVPNExporter) Describe(ch chan<- *prometheus.Desc) {
 	ch <- e.openvpnUpDesc
+	ch <- e.openvpnSnapshotAgeDesc
+	e.openvpnStatusErrors.Describe(ch)
+	e.openvpnIncompleteReads.Describe(ch)
+	ch <- e.openvpnStatusUpdateTimeDesc
+	ch <- e.openvpnConnectedClientsDesc
+	ch <- e.openvpnClientsByProtoDesc
+	ch <- e.openvpnRoutesDesc
+	ch <- e.openvpnRoutedSubnetDesc
+	ch <- e.openvpnOrphanRoutesDesc
+	ch <- e.openvpnClientsWithoutRouteDesc
+	ch <- e.openvpnAddressConflictsDesc
+	ch <- e.openvpnDuplicateSessionsDesc
+	ch <- e.openvpnServerInfoDesc
+	ch <- e.openvpnServerFeatureDesc
+	for _, desc := range e.openvpnClientDescs {
+		ch <- desc
+	}
+	for _, header := range e.openvpnServerHeaders {
+		for _, metric := range header.Metrics {
+			ch <- metric.Desc
+		}
+	}
 }
 
 func (e *OpenVPNExporter) Collect(ch chan<- prometheus.Metric) {
 	for _, statusPath := range e.statusPaths {
-		if err := e.collectStatusFromFile(statusPath, ch); err == nil {
-			ch <- prometheus.MustNewConstMetric(
-				e.openvpnUpDesc,
-				prometheus.GaugeValue,
-				1.0,
-				statusPath)
-		} else {
-			log.Printf("Failed to scrape showq socket: %s", err)
-			ch <- prometheus.MustNewConstMetric(
-				e.openvpnUpDesc,
-				prometheus.GaugeValue,
-				0.0,
-				statusPath)
+		snapshot := e.snapshot(statusPath)
+		for _, metric := range snapshot.metrics {
+			ch <- metric
+		}
+		up := 1.0
+		if snapshot.err != nil {
+			up = 0.0
 		}
+		label := sanitizeLabelValues([]string{statusPath})[0]
+		ch <- prometheus.MustNewConstMetric(
+			e.openvpnUpDesc,
+			prometheus.GaugeValue,
+			up,
+			label)
+		ch <- prometheus.MustNewConstMetric(
+			e.openvpnSnapshotAgeDesc,
+			prometheus.GaugeValue,
+			time.Since(snapshot.time).Seconds(),
+			label)
 	}
+	e.openvpnStatusErrors.Collect(ch)
+	e.openvpnIncompleteReads.Collect(ch)
 }
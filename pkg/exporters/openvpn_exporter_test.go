@@ -1,7 +1,19 @@
 package exporters
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/common/expfmt"
 )
 
 func TestNewOpenVPNExporter(t *testing.T) {
@@ -13,3 +25,333 @@ func TestCollectStatusFromReader(t *testing.T) {
 func TestCollectServerStatusFromReader(t *testing.T) {
 
 }
+
+// Copies an example status file to a temporary directory, so that tests
+// can remove it.
+func copyStatus(t *testing.T, example string) string {
+	status, err := os.ReadFile(example)
+	if err != nil {
+		t.Fatal(err)
+	}
+	statusPath := filepath.Join(t.TempDir(), "server.status")
+	if err := os.WriteFile(statusPath, status, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return statusPath
+}
+
+func expectUp(t *testing.T, e *OpenVPNExporter, statusPath string, up string) {
+	t.Helper()
+	expected := `# HELP openvpn_up Whether scraping OpenVPN's metrics was successful.
+# TYPE openvpn_up gauge
+openvpn_up{status_path="` + statusPath + `"} ` + up + "\n"
+	if err := testutil.CollectAndCompare(e, strings.NewReader(expected), "openvpn_up"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestMinRefreshInterval(t *testing.T) {
+	statusPath := copyStatus(t, "../../examples/version-2.4/server.status")
+	e, err := NewOpenVPNExporter([]string{statusPath}, false, "2.4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.SetMinRefreshInterval(statusPath, time.Hour)
+	expectUp(t, e, statusPath, "1")
+
+	// Scrapes within the interval are served from the previous read.
+	if err := os.Remove(statusPath); err != nil {
+		t.Fatal(err)
+	}
+	expectUp(t, e, statusPath, "1")
+
+	e.SetMinRefreshInterval(statusPath, 0)
+	expectUp(t, e, statusPath, "0")
+}
+
+func TestRun(t *testing.T) {
+	statusPath := copyStatus(t, "../../examples/version-2.4/server.status")
+	e, err := NewOpenVPNExporter([]string{statusPath}, false, "2.4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		e.Run(ctx, time.Hour)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+	expectUp(t, e, statusPath, "1")
+
+	// Scrapes never read the status while it is polled in the background.
+	if err := os.Remove(statusPath); err != nil {
+		t.Fatal(err)
+	}
+	expectUp(t, e, statusPath, "1")
+
+	metrics, err := testutil.CollectAndFormat(e, expfmt.TypeTextPlain, "openvpn_status_snapshot_age_seconds")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(metrics), `openvpn_status_snapshot_age_seconds{status_path="`+statusPath+`"}`) {
+		t.Errorf("expected snapshot age, got:\n%s", metrics)
+	}
+}
+
+func TestPending(t *testing.T) {
+	statusPath := copyStatus(t, "../../examples/version-2.4/server.status")
+	missingPath := filepath.Join(t.TempDir(), "missing.status")
+	e, err := NewOpenVPNExporter([]string{statusPath, missingPath}, false, "2.4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pending := e.Pending(); !slices.Equal(pending, []string{statusPath, missingPath}) {
+		t.Errorf("expected both paths to be pending, got %v", pending)
+	}
+	e.ReadPending()
+	if pending := e.Pending(); !slices.Equal(pending, []string{missingPath}) {
+		t.Errorf("expected the missing path to be pending, got %v", pending)
+	}
+
+	// Paths stay ready once they have been read successfully.
+	if err := os.Remove(statusPath); err != nil {
+		t.Fatal(err)
+	}
+	if snapshot := e.readSnapshot(statusPath); snapshot.err == nil {
+		t.Fatal("expected error for removed status")
+	}
+	if pending := e.Pending(); !slices.Equal(pending, []string{missingPath}) {
+		t.Errorf("expected the missing path to be pending, got %v", pending)
+	}
+}
+
+func TestInvalidUTF8(t *testing.T) {
+	status := "TITLE,OpenVPN 2.3.2\nTIME,Tue Mar 21 10:39:14 2017,1490089154\n" +
+		"HEADER,CLIENT_LIST,Common Name,Real Address,Virtual Address,Bytes Received,Bytes Sent,Connected Since,Connected Since (time_t),Username\n" +
+		"CLIENT_LIST,M\xfcller,198.51.100.1:1194,10.8.0.6,1,2,Thu Mar 16 17:09:03 2017,1489680543,UNDEF\n" +
+		"END\n"
+	statusPath := filepath.Join(t.TempDir(), "server.status")
+	if err := os.WriteFile(statusPath, []byte(status), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	e, err := NewOpenVPNExporter([]string{statusPath}, true, "2.3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `# HELP openvpn_server_client_sent_bytes_total Amount of data sent over a connection on the VPN server, in bytes.
+# TYPE openvpn_server_client_sent_bytes_total counter
+openvpn_server_client_sent_bytes_total{common_name="M�ller",status_path="` + statusPath + `"} 2
+`
+	if err := testutil.CollectAndCompare(e, strings.NewReader(expected), "openvpn_server_client_sent_bytes_total"); err != nil {
+		t.Error(err)
+	}
+	expectUp(t, e, statusPath, "1")
+}
+
+// Rows whose labels are equal once invalid UTF-8 is replaced are
+// duplicates, whether their common names are the same or not.
+func TestInvalidUTF8Duplicates(t *testing.T) {
+	for _, commonNames := range [][2]string{
+		{"M\xfcller", "M\xfcller"},
+		{"M\xfcller", "M\xfdller"},
+	} {
+		status := "TITLE,OpenVPN 2.3.2\nTIME,Tue Mar 21 10:39:14 2017,1490089154\n" +
+			"HEADER,CLIENT_LIST,Common Name,Real Address,Virtual Address,Bytes Received,Bytes Sent,Connected Since,Connected Since (time_t),Username\n" +
+			"CLIENT_LIST," + commonNames[0] + ",198.51.100.1:1194,10.8.0.6,1,2,Thu Mar 16 17:09:03 2017,1489680543,UNDEF\n" +
+			"CLIENT_LIST," + commonNames[1] + ",198.51.100.2:1194,10.8.0.10,3,4,Thu Mar 16 17:09:03 2017,1489680543,UNDEF\n" +
+			"END\n"
+		statusPath := filepath.Join(t.TempDir(), "server.status")
+		if err := os.WriteFile(statusPath, []byte(status), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		for _, test := range []struct {
+			policy string
+			sent   string
+		}{
+			{DuplicateFirst, "2"},
+			{DuplicateSum, "6"},
+		} {
+			e, err := NewOpenVPNExporter([]string{statusPath}, true, "2.3")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := e.SetDuplicatePolicy(test.policy); err != nil {
+				t.Fatal(err)
+			}
+			expected := `# HELP openvpn_server_client_sent_bytes_total Amount of data sent over a connection on the VPN server, in bytes.
+# TYPE openvpn_server_client_sent_bytes_total counter
+openvpn_server_client_sent_bytes_total{common_name="M�ller",status_path="` + statusPath + `"} ` + test.sent + `
+`
+			if err := testutil.CollectAndCompare(e, strings.NewReader(expected), "openvpn_server_client_sent_bytes_total"); err != nil {
+				t.Errorf("%q, %s: %s", commonNames, test.policy, err)
+			}
+			expectUp(t, e, statusPath, "1")
+		}
+	}
+}
+
+// Statuses whose metrics cannot be built are reported as down, without
+// affecting the others.
+func TestStatusErrors(t *testing.T) {
+	statusPath := copyStatus(t, "../../examples/version-2.4/server.status")
+	clientPath := "../../examples/version-2.3/client.status"
+	e, err := NewOpenVPNExporter([]string{statusPath, clientPath}, false, "2.4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A label without a matching label name.
+	header := e.openvpnServerHeaders["CLIENT_LIST"]
+	header.LabelColumns = append(header.LabelColumns, "Bytes Sent")
+	e.openvpnServerHeaders["CLIENT_LIST"] = header
+
+	expected := `# HELP openvpn_status_errors_total Number of times reading or parsing the OpenVPN statistics failed.
+# TYPE openvpn_status_errors_total counter
+openvpn_status_errors_total{status_path="` + clientPath + `"} 0
+openvpn_status_errors_total{status_path="` + statusPath + `"} 1
+# HELP openvpn_up Whether scraping OpenVPN's metrics was successful.
+# TYPE openvpn_up gauge
+openvpn_up{status_path="` + clientPath + `"} 1
+openvpn_up{status_path="` + statusPath + `"} 0
+`
+	if err := testutil.CollectAndCompare(e, strings.NewReader(expected), "openvpn_up", "openvpn_status_errors_total"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestStatusPanic(t *testing.T) {
+	statusPath := "../../examples/version-2.4/server.status"
+	e, err := NewOpenVPNExporter([]string{statusPath}, false, "2.4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.openvpnServerHeaders["CLIENT_LIST"].Metrics[0].Desc = nil
+	if snapshot := e.readSnapshot(statusPath); snapshot.err == nil || !strings.Contains(snapshot.err.Error(), "panic") {
+		t.Errorf("expected error for panic, got %v", snapshot.err)
+	}
+	if errors := testutil.ToFloat64(e.openvpnStatusErrors.WithLabelValues(statusPath)); errors != 1 {
+		t.Errorf("expected 1 error, got %v", errors)
+	}
+}
+
+func TestIncompleteStatus(t *testing.T) {
+	defer func(delay time.Duration) { incompleteRetryDelay = delay }(incompleteRetryDelay)
+	incompleteRetryDelay = time.Millisecond
+
+	statusPath := copyStatus(t, "../../examples/version-2.4/server.status")
+	status, err := os.ReadFile(statusPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Status cut off in the middle of a row of the client list, while
+	// OpenVPN was writing it.
+	truncated := status[:bytes.Index(status, []byte("client3,95.155.112.75:45338,620"))+len("client3,95.155.112.75:45338,620")]
+
+	expected := func(up string, clients string, incompleteReads string, errors string) string {
+		return `# HELP openvpn_server_connected_clients Number Of Connected Clients
+# TYPE openvpn_server_connected_clients gauge
+openvpn_server_connected_clients{status_path="` + statusPath + `"} ` + clients + `
+# HELP openvpn_status_errors_total Number of times reading or parsing the OpenVPN statistics failed.
+# TYPE openvpn_status_errors_total counter
+openvpn_status_errors_total{status_path="` + statusPath + `"} ` + errors + `
+# HELP openvpn_status_incomplete_reads_total Number of times the OpenVPN statistics were read while being rewritten, lacking the END line.
+# TYPE openvpn_status_incomplete_reads_total counter
+openvpn_status_incomplete_reads_total{status_path="` + statusPath + `"} ` + incompleteReads + `
+# HELP openvpn_up Whether scraping OpenVPN's metrics was successful.
+# TYPE openvpn_up gauge
+openvpn_up{status_path="` + statusPath + `"} ` + up + `
+`
+	}
+	names := []string{"openvpn_up", "openvpn_server_connected_clients", "openvpn_status_incomplete_reads_total", "openvpn_status_errors_total"}
+
+	// Without a complete snapshot to fall back to, the status is down.
+	if err := os.WriteFile(statusPath, truncated, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	e, err := NewOpenVPNExporter([]string{statusPath}, false, "2.4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectUp(t, e, statusPath, "0")
+	if reads := testutil.ToFloat64(e.openvpnIncompleteReads); reads != float64(1+incompleteRetries) {
+		t.Errorf("expected %d incomplete reads, got %v", 1+incompleteRetries, reads)
+	}
+
+	e, err = NewOpenVPNExporter([]string{statusPath}, false, "2.4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(statusPath, status, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := testutil.CollectAndCompare(e, strings.NewReader(expected("1", "4", "0", "0")), names...); err != nil {
+		t.Error(err)
+	}
+
+	// The last complete snapshot is served instead of partial data.
+	if err := os.WriteFile(statusPath, truncated, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := testutil.CollectAndCompare(e, strings.NewReader(expected("1", "4", "4", "0")), names...); err != nil {
+		t.Error(err)
+	}
+
+	if err := os.WriteFile(statusPath, status, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := testutil.CollectAndCompare(e, strings.NewReader(expected("1", "4", "4", "0")), names...); err != nil {
+		t.Error(err)
+	}
+
+	if _, err := ParseClientList(bytes.NewReader(truncated), nil); !errors.Is(err, errIncompleteStatus) {
+		t.Errorf("expected incomplete status error, got %v", err)
+	}
+
+	// Rows that fail to parse are not mistaken for an incomplete status if
+	// the status has an END line.
+	malformed := bytes.Replace(status, []byte("client3,95.155.112.75:45338,62037537,"), []byte("client3,95.155.112.75:45338,"), 1)
+	if _, err := ParseClientList(bytes.NewReader(malformed), nil); err == nil || errors.Is(err, errIncompleteStatus) {
+		t.Errorf("expected parse error, got %v", err)
+	}
+}
+
+func TestLocation(t *testing.T) {
+	location := time.FixedZone("UTC+2", 2*60*60)
+	tests := []struct {
+		statusPath string
+		updated    time.Time
+	}{
+		{"../../examples/version-2.3/client.status", time.Date(2017, 3, 21, 10, 39, 9, 0, location)},
+		{"../../examples/version-2.4/server.status", time.Date(2024, 9, 18, 10, 46, 33, 0, location)},
+	}
+	for _, test := range tests {
+		e, err := NewOpenVPNExporter([]string{test.statusPath}, false, "2.4")
+		if err != nil {
+			t.Fatal(err)
+		}
+		e.SetLocation(test.statusPath, location)
+		expected := fmt.Sprintf(`# HELP openvpn_status_update_time_seconds UNIX timestamp at which the OpenVPN statistics were updated.
+# TYPE openvpn_status_update_time_seconds gauge
+openvpn_status_update_time_seconds{status_path="%s"} %d
+`, test.statusPath, test.updated.Unix())
+		if err := testutil.CollectAndCompare(e, strings.NewReader(expected), "openvpn_status_update_time_seconds"); err != nil {
+			t.Errorf("%s: %s", test.statusPath, err)
+		}
+	}
+
+	file, err := os.Open("../../examples/version-2.4/server.status")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	clients, err := ParseClientList(file, location)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := time.Date(2024, 9, 18, 9, 8, 11, 0, location); !clients[0].ConnectedSince.Equal(want) {
+		t.Errorf("expected connection time %s, got %s", want, clients[0].ConnectedSince)
+	}
+}
@@ -1,10 +1,10 @@
 package exporters
 
 import (
-	"bufio"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
@@ -13,228 +13,500 @@ import (
 )
 
 // Converts OpenVPN client status information into Prometheus metrics.
-func (e *OpenVPNExporter) collectClientStatusFromReader(statusPath string, file io.Reader, ch chan<- prometheus.Metric) error {
-	scanner := bufio.NewScanner(file)
-	scanner.Split(bufio.ScanLines)
+func (e *OpenVPNExporter) collectClientStatusFromReader(statusPath string, file io.Reader, ch chan<- prometheus.Metric) (err error) {
+	scanner := newLineReader(file)
+	var fields []string
+	complete := false
+	defer func() {
+		if err != nil && !complete {
+			err = scanner.parseError(err)
+		}
+	}()
 	for scanner.Scan() {
-		fields := strings.Split(scanner.Text(), ",")
+		fields = splitFields(fields, scanner.Text(), ",")
 		if fields[0] == "END" && len(fields) == 1 {
 			// Stats footer.
+			complete = true
 		} else if fields[0] == "OpenVPN STATISTICS" && len(fields) == 1 {
 			// Stats header.
 		} else if fields[0] == "Updated" && len(fields) == 2 {
 			// Time at which the statistics were updated.
-			location, _ := time.LoadLocation("Local")
-			timeParser, err := time.ParseInLocation("Mon Jan 2 15:04:05 2006", fields[1], location)
+			timeParser, err := parseStatusTime(fields[1], e.locations[statusPath])
 			if err != nil {
 				return fmt.Errorf("failed to parse updated time: %v", err)
 			}
-			ch <- prometheus.MustNewConstMetric(
+			if err := sendMetric(ch,
 				e.openvpnStatusUpdateTimeDesc,
 				prometheus.GaugeValue,
 				float64(timeParser.Unix()),
-				statusPath)
+				statusPath); err != nil {
+				return err
+			}
 		} else if desc, ok := e.openvpnClientDescs[fields[0]]; ok && len(fields) == 2 {
 			// Traffic counters.
 			value, err := strconv.ParseFloat(fields[1], 64)
 			if err != nil {
 				return fmt.Errorf("failed to parse traffic counter value: %v", err)
 			}
-			ch <- prometheus.MustNewConstMetric(
+			if err := sendMetric(ch,
 				desc,
 				prometheus.CounterValue,
 				value,
-				statusPath)
+				statusPath); err != nil {
+				return err
+			}
 		} else {
 			return fmt.Errorf("unsupported key: %q", fields[0])
 		}
 	}
-	return scanner.Err()
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if !complete {
+		return errIncompleteStatus
+	}
+	return nil
 }
 
-// Converts OpenVPN server version 2.3 status information into Prometheus metrics.
-func (e *OpenVPNExporter) collectServer23StatusFromReader(statusPath string, file io.Reader, ch chan<- prometheus.Metric, separator string) error {
-	scanner := bufio.NewScanner(file)
-	scanner.Split(bufio.ScanLines)
-	headersFound := map[string][]string{}
-	// counter of connected client
-	numberConnectedClient := 0
+// Ways of handling rows of a section with the same labels as a previous
+// row, which would otherwise result in metrics that cannot be told apart.
+// Such rows are exported once, with the values of the first or last of
+// them, or their sum or maximum. Only counters are summed, as the sum of
+// gauges such as the time at which a route was last referenced is
+// meaningless; their maximum is exported instead.
+const (
+	DuplicateFirst = "first"
+	DuplicateLast  = "last"
+	DuplicateSum   = "sum"
+	DuplicateMax   = "max"
+)
 
-	recordedMetrics := map[OpenvpnServerHeaderField][]string{}
+func IsValidDuplicatePolicy(policy string) bool {
+	switch policy {
+	case DuplicateFirst, DuplicateLast, DuplicateSum, DuplicateMax:
+		return true
+	}
+	return false
+}
+
+// Positions of the columns of a CLIENT_LIST or ROUTING_TABLE section that
+// are exported or read into the client list, determined once from the
+// column names of the section rather than for every row.
+type rowLayout struct {
+	section     string
+	header      OpenvpnServerHeader
+	columnNames []string
+	// Index of the column of every label and metric, or -1 if the
+	// section has no such column.
+	labelIndexes  []int
+	metricIndexes []int
+	// Index of the Real Address column, or -1, and of the label it is
+	// exported as, which is split into protocol, IP address and port.
+	realAddressIndex int
+	realAddressLabel int
+	// Indexes of the Virtual Address and Common Name columns, or -1, and
+	// of the label of the virtual address of routing table entries,
+	// which is exported without flags.
+	virtualAddressIndex int
+	commonNameIndex     int
+	routeLabel          int
+	policy              string
+	// Label values of the rows seen so far. Unless only the first of
+	// duplicate rows is exported, rows are only exported at the end of
+	// the section, so their values are kept in the same order.
+	seen   *labelSet
+	values [][]float64
+}
+
+func newRowLayout(section string, header OpenvpnServerHeader, columnNames []string, policy string) *rowLayout {
+	layout := &rowLayout{
+		section:       section,
+		header:        header,
+		columnNames:   slices.Clone(columnNames),
+		labelIndexes:  make([]int, len(header.LabelColumns)),
+		metricIndexes: make([]int, len(header.Metrics)),
+		policy:        policy,
+		seen:          newLabelSet(),
+	}
+	layout.realAddressIndex = slices.Index(columnNames, "Real Address")
+	layout.realAddressLabel = slices.Index(header.LabelColumns, "Real Address")
+	layout.virtualAddressIndex = slices.Index(columnNames, "Virtual Address")
+	layout.commonNameIndex = slices.Index(columnNames, "Common Name")
+	layout.routeLabel = -1
+	if section == "ROUTING_TABLE" {
+		layout.routeLabel = slices.Index(header.LabelColumns, "Virtual Address")
+	}
+	for i, column := range header.LabelColumns {
+		layout.labelIndexes[i] = slices.Index(columnNames, column)
+	}
+	for i, metric := range header.Metrics {
+		layout.metricIndexes[i] = slices.Index(columnNames, metric.Column)
+	}
+	return layout
+}
 
+// Exports the metrics of a row of a section, given its column values, or
+// merges them with those of a previous row with the same labels.
+func (e *OpenVPNExporter) collectRow(statusPath string, layout *rowLayout, fields []string, ch chan<- prometheus.Metric) error {
+	labels := make([]string, 1, 3+len(layout.labelIndexes))
+	labels[0] = statusPath
+	for i, index := range layout.labelIndexes {
+		value := ""
+		if index >= 0 {
+			value = fields[index]
+		}
+		if i == layout.realAddressLabel {
+			address := parseRealAddress(value)
+			if e.ignoreRealPort {
+				address.port = ""
+			}
+			labels = append(labels, address.proto, address.ip, address.port)
+		} else if i == layout.routeLabel {
+			address, _ := parseRoute(value)
+			labels = append(labels, address)
+		} else {
+			labels = append(labels, value)
+		}
+	}
+	// Rows are told apart by the label values they are exported with, so
+	// that invalid UTF-8 that is replaced in the same way does not result
+	// in duplicate metrics.
+	labels = sanitizeLabelValues(labels)
+	row, added := layout.seen.add(labels)
+	if !added && layout.policy == DuplicateFirst {
+		slog.Warn("Skipping status entry with the same labels as a previous one", "status_path", statusPath, "labels", strings.Join(labels[1:], ","))
+		return nil
+	}
+
+	values := make([]float64, len(layout.header.Metrics))
+	for i, index := range layout.metricIndexes {
+		if index < 0 {
+			continue
+		}
+		value, err := strconv.ParseFloat(fields[index], 64)
+		if err != nil {
+			return err
+		}
+		values[i] = value
+	}
+	if layout.policy == DuplicateFirst {
+		for i, metric := range layout.header.Metrics {
+			if layout.metricIndexes[i] >= 0 {
+				if err := sendMetric(ch,
+					metric.Desc,
+					metric.ValueType,
+					values[i],
+					labels...); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	if added {
+		layout.values = append(layout.values, values)
+		return nil
+	}
+
+	slog.Debug("Merging status entry with the same labels as a previous one", "status_path", statusPath, "labels", strings.Join(labels[1:], ","), "policy", layout.policy)
+	merged := layout.values[row]
+	for i, value := range values {
+		switch layout.policy {
+		case DuplicateLast:
+			merged[i] = value
+		case DuplicateSum:
+			if layout.header.Metrics[i].ValueType == prometheus.CounterValue {
+				merged[i] += value
+			} else {
+				merged[i] = max(merged[i], value)
+			}
+		case DuplicateMax:
+			merged[i] = max(merged[i], value)
+		}
+	}
+	return nil
+}
+
+// Exports the rows of a section kept until its end.
+func (e *OpenVPNExporter) flushRows(layout *rowLayout, ch chan<- prometheus.Metric) error {
+	for row, values := range layout.values {
+		for i, metric := range layout.header.Metrics {
+			if layout.metricIndexes[i] >= 0 {
+				if err := sendMetric(ch,
+					metric.Desc,
+					metric.ValueType,
+					values[i],
+					layout.seen.tuples[row]...); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	layout.values = nil
+	return nil
+}
+
+// Counts a row of a client list by the protocol and address family of the
+// client.
+func countClientProto(clientsByProto map[realAddress]int, layout *rowLayout, row []string) {
+	if layout.realAddressIndex < 0 {
+		return
+	}
+	address := parseRealAddress(row[layout.realAddressIndex])
+	clientsByProto[realAddress{proto: address.proto, family: address.family}]++
+}
+
+func (e *OpenVPNExporter) collectClientsByProto(statusPath string, clientsByProto map[realAddress]int, ch chan<- prometheus.Metric) error {
+	for address, count := range clientsByProto {
+		if err := sendMetric(ch,
+			e.openvpnClientsByProtoDesc,
+			prometheus.GaugeValue,
+			float64(count),
+			statusPath, address.proto, address.family); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Numbers of routing table entries of every kind, and the subnets routed
+// to every client.
+type routeStats struct {
+	kinds   map[string]int
+	subnets *labelSet
+}
+
+func newRouteStats() *routeStats {
+	return &routeStats{kinds: map[string]int{}, subnets: newLabelSet()}
+}
+
+// Counts a row of a routing table.
+func (r *routeStats) count(layout *rowLayout, row []string) {
+	if layout.virtualAddressIndex < 0 {
+		return
+	}
+	address, kind := parseRoute(row[layout.virtualAddressIndex])
+	r.kinds[kind]++
+	if kind == routeSubnet && layout.commonNameIndex >= 0 {
+		r.subnets.add([]string{row[layout.commonNameIndex], address})
+	}
+}
+
+func (e *OpenVPNExporter) collectRoutes(statusPath string, routes *routeStats, ch chan<- prometheus.Metric) error {
+	for _, kind := range routeKinds {
+		if err := sendMetric(ch,
+			e.openvpnRoutesDesc,
+			prometheus.GaugeValue,
+			float64(routes.kinds[kind]),
+			statusPath, kind); err != nil {
+			return err
+		}
+	}
+	for _, subnet := range routes.subnets.tuples {
+		if err := sendMetric(ch,
+			e.openvpnRoutedSubnetDesc,
+			prometheus.GaugeValue,
+			1,
+			statusPath, subnet[0], subnet[1]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Exports the build of the server described by the TITLE line of its
+// status. Titles of unknown form are ignored.
+func (e *OpenVPNExporter) collectTitle(statusPath string, title string, ch chan<- prometheus.Metric) error {
+	build, ok := parseTitle(title)
+	if !ok {
+		slog.Debug("Ignoring unrecognized status title", "status_path", statusPath, "title", title)
+		return nil
+	}
+	if err := sendMetric(ch,
+		e.openvpnServerInfoDesc,
+		prometheus.GaugeValue,
+		1,
+		statusPath, build.version, build.platform, build.sslLibrary); err != nil {
+		return err
+	}
+	for _, feature := range build.features {
+		if err := sendMetric(ch,
+			e.openvpnServerFeatureDesc,
+			prometheus.GaugeValue,
+			1,
+			statusPath, feature); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Sections of a server status whose rows are passed to a
+// serverStatusHandler.
+var serverSections = []string{"CLIENT_LIST", "ROUTING_TABLE"}
+
+// Receives the contents of a server status as it is parsed, so that the
+// exporter and the client list are built from the same rows.
+type serverStatusHandler interface {
+	// Returns the layout of the rows of a section, given its column names.
+	newLayout(section string, columnNames []string) *rowLayout
+	// Handles a row of a section, given its column values.
+	row(layout *rowLayout, row []string) error
+	// Handles the end of a section, or of the rows of a layout replaced by
+	// a later header.
+	endSection(layout *rowLayout) error
+	// Handles the TITLE line of status format versions 2 and 3.
+	title(title string) error
+	// Handles the time at which the status was updated, as a UNIX
+	// timestamp.
+	updated(timestamp float64) error
+}
+
+// Starts a section, ending the previous layout of it, if any.
+func startSection(handler serverStatusHandler, layouts map[string]*rowLayout, section string, columnNames []string) error {
+	if layout, ok := layouts[section]; ok {
+		if err := handler.endSection(layout); err != nil {
+			return err
+		}
+	}
+	layouts[section] = handler.newLayout(section, columnNames)
+	return nil
+}
+
+func endSections(handler serverStatusHandler, layouts map[string]*rowLayout) error {
+	for _, layout := range layouts {
+		if err := handler.endSection(layout); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Parses server status format versions 2 and 3. The only difference
+// between them is that version 3 uses tabs instead of commas.
+func parseServer23Status(file io.Reader, separator string, handler serverStatusHandler) (err error) {
+	scanner := newLineReader(file)
+	layouts := map[string]*rowLayout{}
+	var fields []string
+	complete := false
+	defer func() {
+		if err != nil && !complete {
+			err = scanner.parseError(err)
+		}
+	}()
 	for scanner.Scan() {
-		fields := strings.Split(scanner.Text(), separator)
+		fields = splitFields(fields, scanner.Text(), separator)
 		if fields[0] == "END" && len(fields) == 1 {
 			// Stats footer.
+			complete = true
 		} else if fields[0] == "GLOBAL_STATS" {
 			// Global server statistics.
 		} else if fields[0] == "HEADER" && len(fields) > 2 {
 			// Column names for CLIENT_LIST and ROUTING_TABLE.
-			headersFound[fields[1]] = fields[2:]
+			if slices.Contains(serverSections, fields[1]) {
+				if err := startSection(handler, layouts, fields[1], fields[2:]); err != nil {
+					return err
+				}
+			}
 		} else if fields[0] == "TIME" && len(fields) == 3 {
 			// Time at which the statistics were updated.
 			timeStartStats, err := strconv.ParseFloat(fields[2], 64)
 			if err != nil {
 				return err
 			}
-			ch <- prometheus.MustNewConstMetric(
-				e.openvpnStatusUpdateTimeDesc,
-				prometheus.GaugeValue,
-				timeStartStats,
-				statusPath)
+			if err := handler.updated(timeStartStats); err != nil {
+				return err
+			}
 		} else if fields[0] == "TITLE" && len(fields) == 2 {
-			// OpenVPN version number.
-		} else if header, ok := e.openvpnServerHeaders[fields[0]]; ok {
-			if fields[0] == "CLIENT_LIST" {
-				numberConnectedClient++
+			// OpenVPN version, platform and build features.
+			if err := handler.title(fields[1]); err != nil {
+				return err
 			}
+		} else if slices.Contains(serverSections, fields[0]) {
 			// Entry that depends on a preceding HEADERS directive.
-			columnNames, ok := headersFound[fields[0]]
+			layout, ok := layouts[fields[0]]
 			if !ok {
 				return fmt.Errorf("%s should be preceded by HEADERS", fields[0])
 			}
-			if len(fields) != len(columnNames)+1 {
+			row, ok := fitColumns(fields[1:], layout.columnNames, separator)
+			if !ok {
 				return fmt.Errorf("HEADER for %s describes a different number of columns", fields[0])
 			}
-
-			// Store entry values in a map indexed by column name.
-			columnValues := map[string]string{}
-			for _, column := range header.LabelColumns {
-				columnValues[column] = ""
-			}
-			for i, column := range columnNames {
-				columnValues[column] = fields[i+1]
-			}
-
-			// Extract columns that should act as entry labels.
-			labels := []string{statusPath}
-			for _, column := range header.LabelColumns {
-				labels = append(labels, columnValues[column])
-			}
-
-			// Export relevant columns as individual metrics.
-			for _, metric := range header.Metrics {
-				if columnValue, ok := columnValues[metric.Column]; ok {
-					if l := recordedMetrics[metric]; !subslice(labels, l) {
-						value, err := strconv.ParseFloat(columnValue, 64)
-						if err != nil {
-							return err
-						}
-						ch <- prometheus.MustNewConstMetric(
-							metric.Desc,
-							metric.ValueType,
-							value,
-							labels...)
-						recordedMetrics[metric] = append(recordedMetrics[metric], labels...)
-					} else {
-						log.Printf("Metric entry with same labels: %s, %s", metric.Column, labels)
-					}
-				}
+			if err := handler.row(layout, row); err != nil {
+				return err
 			}
 		} else {
 			return fmt.Errorf("unsupported key: %q", fields[0])
 		}
 	}
-	// add the number of connected client
-	ch <- prometheus.MustNewConstMetric(
-		e.openvpnConnectedClientsDesc,
-		prometheus.GaugeValue,
-		float64(numberConnectedClient),
-		statusPath)
-	return scanner.Err()
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if !complete {
+		return errIncompleteStatus
+	}
+	return endSections(handler, layouts)
 }
 
-// Converts OpenVPN server version 2.4 status information into Prometheus metrics.
-func (e *OpenVPNExporter) collectServer24StatusFromReader(statusPath string, file io.Reader, ch chan<- prometheus.Metric, separator string) error {
-	scanner := bufio.NewScanner(file)
-	scanner.Split(bufio.ScanLines)
-	headersFound := map[string][]string{}
-	// counter of connected client
-	numberConnectedClient := 0
-
-	recordedMetrics := map[OpenvpnServerHeaderField][]string{}
+// Parses server status format version 1, printing dates in the given time
+// zone or, if nil, that of the host.
+func parseServer24Status(file io.Reader, separator string, location *time.Location, handler serverStatusHandler) (err error) {
+	scanner := newLineReader(file)
+	layouts := map[string]*rowLayout{}
 	currentSection := ""
 
+	var fields []string
+	complete := false
+	defer func() {
+		if err != nil && !complete {
+			err = scanner.parseError(err)
+		}
+	}()
 	for scanner.Scan() {
-		fields := strings.Split(scanner.Text(), separator)
+		fields = splitFields(fields, scanner.Text(), separator)
 		if fields[0] == "END" && len(fields) == 1 {
 			// Stats footer.
-		} else if fields[0] == "OpenVPN CLIENT LIST" {
+			complete = true
+		} else if fields[0] == "OpenVPN CLIENT LIST" && len(fields) == 1 {
 			currentSection = "CLIENT_LIST"
 			// OpenVPN client list.
 		} else if fields[0] == "GLOBAL STATS" && len(fields) == 1 {
 			currentSection = "GLOBAL STATS"
 			// Global server statistics.
-		} else if fields[0] == "OpenVPN CLIENT LIST" && len(fields) == 1 {
-			currentSection = "CLIENT_LIST"
-			// OpenVPN client list.
 		} else if fields[0] == "ROUTING TABLE" && len(fields) == 1 {
 			currentSection = "ROUTING_TABLE"
 			// Routing table.
 		} else if fields[0] == "Virtual Address" && len(fields) > 2 {
 			// Column names for ROUTING_TABLE.
-			headersFound["ROUTING_TABLE"] = fields
+			if err := startSection(handler, layouts, "ROUTING_TABLE", fields); err != nil {
+				return err
+			}
 		} else if fields[0] == "Common Name" && len(fields) > 2 {
 			// Column names for CLIENT_LIST.
-			headersFound["CLIENT_LIST"] = fields
+			if err := startSection(handler, layouts, "CLIENT_LIST", fields); err != nil {
+				return err
+			}
 		} else if fields[0] == "Updated" && len(fields) == 2 {
 			// Time at which the statistics were updated.
-			parsedTime, err := time.Parse(time.ANSIC, fields[1])
+			parsedTime, err := parseStatusTime(fields[1], location)
 			if err != nil {
 				return fmt.Errorf("failed to parse updated time: %v", err)
 			}
-
-			ch <- prometheus.MustNewConstMetric(
-				e.openvpnStatusUpdateTimeDesc,
-				prometheus.GaugeValue,
-				float64(parsedTime.UTC().Unix()),
-				statusPath)
-		} else if header, ok := e.openvpnServerHeaders[currentSection]; ok {
-			if currentSection == "CLIENT_LIST" {
-				numberConnectedClient++
+			if err := handler.updated(float64(parsedTime.Unix())); err != nil {
+				return err
 			}
-			// Entry that depends on a preceding HEADERS directive.
-			columnNames, ok := headersFound[currentSection]
+		} else if slices.Contains(serverSections, currentSection) {
+			// Entry that depends on a preceding header line.
+			layout, ok := layouts[currentSection]
 			if !ok {
 				return fmt.Errorf("failed to find column names for %s", currentSection)
 			}
-			if len(fields) != len(columnNames) {
+			row, ok := fitColumns(fields, layout.columnNames, separator)
+			if !ok {
 				return fmt.Errorf("%s describes a different number of columns", currentSection)
 			}
-
-			// Store entry values in a map indexed by column name.
-			columnValues := map[string]string{}
-			for _, column := range header.LabelColumns {
-				columnValues[column] = ""
-			}
-			for i, column := range columnNames {
-				columnValues[column] = fields[i]
-			}
-
-			// Extract columns that should act as entry labels.
-			labels := []string{statusPath}
-			for _, column := range header.LabelColumns {
-				labels = append(labels, columnValues[column])
-			}
-
-			// Export relevant columns as individual metrics.
-			for _, metric := range header.Metrics {
-				if columnValue, ok := columnValues[metric.Column]; ok {
-					if l := recordedMetrics[metric]; !subslice(labels, l) {
-						value, err := strconv.ParseFloat(columnValue, 64)
-						if err != nil {
-							return err
-						}
-						ch <- prometheus.MustNewConstMetric(
-							metric.Desc,
-							metric.ValueType,
-							value,
-							labels...)
-						recordedMetrics[metric] = append(recordedMetrics[metric], labels...)
-					} else {
-						log.Printf("Metric entry with same labels: %s, %s", metric.Column, labels)
-					}
-				}
+			if err := handler.row(layout, row); err != nil {
+				return err
 			}
 		} else if currentSection == "GLOBAL STATS" {
 			continue
@@ -242,11 +514,104 @@ func (e *OpenVPNExporter) collectServer24StatusFromReader(statusPath string, fil
 			return fmt.Errorf("unsupported key: %q", fields[0])
 		}
 	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if !complete {
+		return errIncompleteStatus
+	}
+	return endSections(handler, layouts)
+}
+
+// Exports the metrics of a server status as it is parsed.
+type serverStatusCollector struct {
+	e          *OpenVPNExporter
+	statusPath string
+	ch         chan<- prometheus.Metric
+	// counter of connected client
+	numberConnectedClient int
+	clientsByProto        map[realAddress]int
+	routes                *routeStats
+	check                 *statusCheck
+}
+
+func (e *OpenVPNExporter) newServerStatusCollector(statusPath string, ch chan<- prometheus.Metric) *serverStatusCollector {
+	return &serverStatusCollector{
+		e:              e,
+		statusPath:     statusPath,
+		ch:             ch,
+		clientsByProto: map[realAddress]int{},
+		routes:         newRouteStats(),
+		check:          newStatusCheck(),
+	}
+}
+
+func (c *serverStatusCollector) newLayout(section string, columnNames []string) *rowLayout {
+	return newRowLayout(section, c.e.openvpnServerHeaders[section], columnNames, c.e.duplicatePolicy)
+}
+
+func (c *serverStatusCollector) row(layout *rowLayout, row []string) error {
+	if layout.section == "CLIENT_LIST" {
+		c.numberConnectedClient++
+		countClientProto(c.clientsByProto, layout, row)
+		c.check.addClient(layout, row)
+	} else {
+		c.routes.count(layout, row)
+		c.check.addRoute(layout, row)
+	}
+	return c.e.collectRow(c.statusPath, layout, row, c.ch)
+}
+
+func (c *serverStatusCollector) endSection(layout *rowLayout) error {
+	return c.e.flushRows(layout, c.ch)
+}
+
+func (c *serverStatusCollector) title(title string) error {
+	return c.e.collectTitle(c.statusPath, title, c.ch)
+}
+
+func (c *serverStatusCollector) updated(timestamp float64) error {
+	return sendMetric(c.ch,
+		c.e.openvpnStatusUpdateTimeDesc,
+		prometheus.GaugeValue,
+		timestamp,
+		c.statusPath)
+}
+
+// Exports the metrics summarizing the whole status, once it has been
+// parsed.
+func (c *serverStatusCollector) collectSummary() error {
 	// add the number of connected client
-	ch <- prometheus.MustNewConstMetric(
-		e.openvpnConnectedClientsDesc,
+	if err := sendMetric(c.ch,
+		c.e.openvpnConnectedClientsDesc,
 		prometheus.GaugeValue,
-		float64(numberConnectedClient),
-		statusPath)
-	return scanner.Err()
+		float64(c.numberConnectedClient),
+		c.statusPath); err != nil {
+		return err
+	}
+	if err := c.e.collectClientsByProto(c.statusPath, c.clientsByProto, c.ch); err != nil {
+		return err
+	}
+	if err := c.e.collectRoutes(c.statusPath, c.routes, c.ch); err != nil {
+		return err
+	}
+	return c.e.collectStatusCheck(c.statusPath, c.check, c.ch)
+}
+
+// Converts OpenVPN server version 2.3 status information into Prometheus metrics.
+func (e *OpenVPNExporter) collectServer23StatusFromReader(statusPath string, file io.Reader, ch chan<- prometheus.Metric, separator string) error {
+	collector := e.newServerStatusCollector(statusPath, ch)
+	if err := parseServer23Status(file, separator, collector); err != nil {
+		return err
+	}
+	return collector.collectSummary()
+}
+
+// Converts OpenVPN server version 2.4 status information into Prometheus metrics.
+func (e *OpenVPNExporter) collectServer24StatusFromReader(statusPath string, file io.Reader, ch chan<- prometheus.Metric, separator string) error {
+	collector := e.newServerStatusCollector(statusPath, ch)
+	if err := parseServer24Status(file, separator, e.locations[statusPath], collector); err != nil {
+		return err
+	}
+	return collector.collectSummary()
 }
@@ -0,0 +1,326 @@
+package exporters
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// Generates the status of a server with the given number of clients, each
+// with a route, in status format version 2 or, for 2.4, version 1.
+func syntheticStatus(version string, clients int) []byte {
+	var status bytes.Buffer
+	if version == "2.4" {
+		status.WriteString("OpenVPN CLIENT LIST\nUpdated,Wed Sep 18 10:46:33 2024\n")
+		status.WriteString("Common Name,Real Address,Bytes Received,Bytes Sent,Connected Since\n")
+		for i := 0; i < clients; i++ {
+			fmt.Fprintf(&status, "client%d,198.51.%d.%d:%d,%d,%d,Wed Sep 18 09:08:11 2024\n", i, i/256%256, i%256, 1024+i%60000, i*1000, i*2000)
+		}
+		status.WriteString("ROUTING TABLE\nVirtual Address,Common Name,Real Address,Last Ref\n")
+		for i := 0; i < clients; i++ {
+			fmt.Fprintf(&status, "10.%d.%d.%d,client%d,198.51.%d.%d:%d,Wed Sep 18 10:46:28 2024\n", i/65536, i/256%256, i%256, i, i/256%256, i%256, 1024+i%60000)
+		}
+		status.WriteString("GLOBAL STATS\nMax bcast/mcast queue length,0\nEND\n")
+		return status.Bytes()
+	}
+	status.WriteString("TITLE,OpenVPN 2.3.2 x86_64-pc-linux-gnu\nTIME,Tue Mar 21 10:39:14 2017,1490089154\n")
+	status.WriteString("HEADER,CLIENT_LIST,Common Name,Real Address,Virtual Address,Bytes Received,Bytes Sent,Connected Since,Connected Since (time_t),Username\n")
+	for i := 0; i < clients; i++ {
+		fmt.Fprintf(&status, "CLIENT_LIST,client%d,198.51.%d.%d:%d,10.%d.%d.%d,%d,%d,Thu Mar 16 17:09:03 2017,1489680543,UNDEF\n", i, i/256%256, i%256, 1024+i%60000, i/65536, i/256%256, i%256, i*1000, i*2000)
+	}
+	status.WriteString("HEADER,ROUTING_TABLE,Virtual Address,Common Name,Real Address,Last Ref,Last Ref (time_t)\n")
+	for i := 0; i < clients; i++ {
+		fmt.Fprintf(&status, "ROUTING_TABLE,10.%d.%d.%d,client%d,198.51.%d.%d:%d,Tue Mar 21 10:26:48 2017,1490088408\n", i/65536, i/256%256, i%256, i, i/256%256, i%256, 1024+i%60000)
+	}
+	status.WriteString("GLOBAL_STATS,Max bcast/mcast queue length,0\nEND\n")
+	return status.Bytes()
+}
+
+// Parses a status, discarding the metrics, and returns how many there were.
+func collectSynthetic(tb testing.TB, e *OpenVPNExporter, status []byte) int {
+	ch := make(chan prometheus.Metric, 1024)
+	done := make(chan int)
+	go func() {
+		count := 0
+		for range ch {
+			count++
+		}
+		done <- count
+	}()
+	err := e.collectStatusFromReader("server.status", bytes.NewReader(status), ch)
+	close(ch)
+	count := <-done
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return count
+}
+
+func TestCollectSyntheticStatus(t *testing.T) {
+	for _, version := range []string{"2.3", "2.4"} {
+		e, err := NewOpenVPNExporter(nil, false, version)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Bytes received and sent for every client, the update time, the
+		// number of connected clients, in total and of IPv4 clients, the
+		// number of routes of each of the four kinds and the four
+		// consistency checks. Version 2.3 also has the last reference time
+		// of every route and the server info.
+		expected := 2*1000 + 3 + 4 + 4
+		if version == "2.3" {
+			expected += 1000 + 1
+		}
+		if count := collectSynthetic(t, e, syntheticStatus(version, 1000)); count != expected {
+			t.Errorf("%s: expected %d metrics, got %d", version, expected, count)
+		}
+	}
+}
+
+// Checks that parsing allocates a bounded amount per client, however many
+// clients a server has.
+func TestCollectAllocations(t *testing.T) {
+	for _, version := range []string{"2.3", "2.4"} {
+		e, err := NewOpenVPNExporter(nil, false, version)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var perClient []float64
+		for _, clients := range []int{1000, 10000} {
+			status := syntheticStatus(version, clients)
+			allocs := testing.AllocsPerRun(3, func() {
+				collectSynthetic(t, e, status)
+			})
+			perClient = append(perClient, allocs/float64(clients))
+		}
+		if perClient[1] > 1.5*perClient[0] {
+			t.Errorf("%s: allocations per client grew from %.1f to %.1f", version, perClient[0], perClient[1])
+		}
+	}
+}
+
+func BenchmarkCollectServerStatus(b *testing.B) {
+	for _, version := range []string{"2.3", "2.4"} {
+		for _, clients := range []int{5000, 50000} {
+			b.Run(fmt.Sprintf("version=%s/clients=%d", version, clients), func(b *testing.B) {
+				e, err := NewOpenVPNExporter(nil, false, version)
+				if err != nil {
+					b.Fatal(err)
+				}
+				status := syntheticStatus(version, clients)
+				b.SetBytes(int64(len(status)))
+				b.ReportAllocs()
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					collectSynthetic(b, e, status)
+				}
+			})
+		}
+	}
+}
+
+func TestDuplicatePolicy(t *testing.T) {
+	status := `TITLE,OpenVPN 2.3.2 x86_64-pc-linux-gnu
+TIME,Tue Mar 21 10:39:14 2017,1490089154
+HEADER,CLIENT_LIST,Common Name,Real Address,Virtual Address,Bytes Received,Bytes Sent,Connected Since,Connected Since (time_t),Username
+CLIENT_LIST,alice,198.51.100.1:1194,10.8.0.6,100,900,Thu Mar 16 17:09:03 2017,1489680543,UNDEF
+CLIENT_LIST,alice,198.51.100.2:1194,10.8.0.10,300,200,Thu Mar 16 17:09:03 2017,1489680543,UNDEF
+CLIENT_LIST,bob,198.51.100.3:1194,10.8.0.14,50,60,Thu Mar 16 17:09:03 2017,1489680543,UNDEF
+HEADER,ROUTING_TABLE,Virtual Address,Common Name,Real Address,Last Ref,Last Ref (time_t)
+END
+`
+	statusPath := filepath.Join(t.TempDir(), "server.status")
+	if err := os.WriteFile(statusPath, []byte(status), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		policy   string
+		received string
+		sent     string
+	}{
+		{DuplicateFirst, "100", "900"},
+		{DuplicateLast, "300", "200"},
+		{DuplicateSum, "400", "1100"},
+		{DuplicateMax, "300", "900"},
+	}
+	for _, test := range tests {
+		e, err := NewOpenVPNExporter([]string{statusPath}, true, "2.3")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := e.SetDuplicatePolicy(test.policy); err != nil {
+			t.Fatal(err)
+		}
+		expected := `# HELP openvpn_server_client_received_bytes_total Amount of data received over a connection on the VPN server, in bytes.
+# TYPE openvpn_server_client_received_bytes_total counter
+openvpn_server_client_received_bytes_total{common_name="alice",status_path="` + statusPath + `"} ` + test.received + `
+openvpn_server_client_received_bytes_total{common_name="bob",status_path="` + statusPath + `"} 50
+# HELP openvpn_server_client_sent_bytes_total Amount of data sent over a connection on the VPN server, in bytes.
+# TYPE openvpn_server_client_sent_bytes_total counter
+openvpn_server_client_sent_bytes_total{common_name="alice",status_path="` + statusPath + `"} ` + test.sent + `
+openvpn_server_client_sent_bytes_total{common_name="bob",status_path="` + statusPath + `"} 60
+`
+		if err := testutil.CollectAndCompare(e, strings.NewReader(expected), "openvpn_server_client_received_bytes_total", "openvpn_server_client_sent_bytes_total"); err != nil {
+			t.Errorf("%s: %s", test.policy, err)
+		}
+	}
+
+	e, err := NewOpenVPNExporter(nil, true, "2.3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := e.SetDuplicatePolicy("average"); err == nil {
+		t.Error("expected error for unknown policy")
+	}
+}
+
+// Gauges of duplicate rows, such as the time at which a route was last
+// referenced, are not summed.
+func TestDuplicatePolicyRoutingTable(t *testing.T) {
+	status := `TITLE,OpenVPN 2.3.2 x86_64-pc-linux-gnu
+TIME,Tue Mar 21 10:39:14 2017,1490089154
+HEADER,CLIENT_LIST,Common Name,Real Address,Virtual Address,Bytes Received,Bytes Sent,Connected Since,Connected Since (time_t),Username
+HEADER,ROUTING_TABLE,Virtual Address,Common Name,Real Address,Last Ref,Last Ref (time_t)
+ROUTING_TABLE,10.8.0.6,alice,198.51.100.1:1194,Thu Mar 16 17:09:03 2017,1489680543
+ROUTING_TABLE,10.8.0.10,alice,198.51.100.2:1194,Tue Mar 21 10:39:13 2017,1490089153
+END
+`
+	statusPath := filepath.Join(t.TempDir(), "server.status")
+	if err := os.WriteFile(statusPath, []byte(status), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		policy  string
+		lastRef string
+	}{
+		{DuplicateFirst, "1.489680543e+09"},
+		{DuplicateLast, "1.490089153e+09"},
+		{DuplicateSum, "1.490089153e+09"},
+		{DuplicateMax, "1.490089153e+09"},
+	}
+	for _, test := range tests {
+		e, err := NewOpenVPNExporter([]string{statusPath}, true, "2.3")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := e.SetDuplicatePolicy(test.policy); err != nil {
+			t.Fatal(err)
+		}
+		expected := `# HELP openvpn_server_route_last_reference_time_seconds Time at which a route was last referenced, in seconds.
+# TYPE openvpn_server_route_last_reference_time_seconds gauge
+openvpn_server_route_last_reference_time_seconds{common_name="alice",status_path="` + statusPath + `"} ` + test.lastRef + `
+`
+		if err := testutil.CollectAndCompare(e, strings.NewReader(expected), "openvpn_server_route_last_reference_time_seconds"); err != nil {
+			t.Errorf("%s: %s", test.policy, err)
+		}
+	}
+}
+
+// Rows are only duplicates if all of their labels are equal, not if each
+// of their labels occurs in some previous row.
+func TestDistinctRowsWithSharedLabelValues(t *testing.T) {
+	status := `TITLE,OpenVPN 2.3.2 x86_64-pc-linux-gnu
+TIME,Tue Mar 21 10:39:14 2017,1490089154
+HEADER,CLIENT_LIST,Common Name,Real Address,Virtual Address,Bytes Received,Bytes Sent,Connected Since,Connected Since (time_t),Username
+CLIENT_LIST,alice,198.51.100.1:1194,10.8.0.6,1,1,Thu Mar 16 17:09:03 2017,1489680543,UNDEF
+CLIENT_LIST,bob,198.51.100.2:1194,10.8.0.10,1,1,Thu Mar 16 17:09:03 2017,1489680543,UNDEF
+CLIENT_LIST,alice,198.51.100.2:1194,10.8.0.6,1,1,Thu Mar 16 17:09:03 2017,1489680543,UNDEF
+END
+`
+	e, err := NewOpenVPNExporter(nil, false, "2.3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Bytes received and sent of three clients, the server info, the
+	// update time, the number of connected clients, in total and of IPv4
+	// clients, the number of routes of each of the four kinds and the four
+	// consistency checks.
+	if count := collectSynthetic(t, e, []byte(status)); count != 18 {
+		t.Errorf("expected 18 metrics, got %d", count)
+	}
+}
+
+func TestRealAddressLabels(t *testing.T) {
+	status := `TITLE,OpenVPN 2.6.12 x86_64-pc-linux-gnu
+TIME,Tue Mar 21 10:39:14 2017,1490089154
+HEADER,CLIENT_LIST,Common Name,Real Address,Virtual Address,Bytes Received,Bytes Sent,Connected Since,Connected Since (time_t),Username
+CLIENT_LIST,alice,udp4:198.51.100.1:50123,10.8.0.6,100,900,Thu Mar 16 17:09:03 2017,1489680543,UNDEF
+CLIENT_LIST,bob,udp6:[2001:db8::1]:50456,10.8.0.10,300,200,Thu Mar 16 17:09:03 2017,1489680543,UNDEF
+CLIENT_LIST,carol,tcp6-server:[::ffff:198.51.100.3]:50789,10.8.0.14,50,60,Thu Mar 16 17:09:03 2017,1489680543,UNDEF
+END
+`
+	statusPath := filepath.Join(t.TempDir(), "server.status")
+	if err := os.WriteFile(statusPath, []byte(status), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, ignoreRealPort := range []bool{false, true} {
+		e, err := NewOpenVPNExporter([]string{statusPath}, false, "2.3")
+		if err != nil {
+			t.Fatal(err)
+		}
+		e.SetIgnoreRealPort(ignoreRealPort)
+		ports := []string{"50123", "50456", "50789"}
+		if ignoreRealPort {
+			ports = []string{"", "", ""}
+		}
+		expected := `# HELP openvpn_server_client_sent_bytes_total Amount of data sent over a connection on the VPN server, in bytes.
+# TYPE openvpn_server_client_sent_bytes_total counter
+openvpn_server_client_sent_bytes_total{common_name="alice",connection_time="1489680543",proto="udp",real_ip="198.51.100.1",real_port="` + ports[0] + `",status_path="` + statusPath + `",username="UNDEF",virtual_address="10.8.0.6"} 900
+openvpn_server_client_sent_bytes_total{common_name="bob",connection_time="1489680543",proto="udp",real_ip="2001:db8::1",real_port="` + ports[1] + `",status_path="` + statusPath + `",username="UNDEF",virtual_address="10.8.0.10"} 200
+openvpn_server_client_sent_bytes_total{common_name="carol",connection_time="1489680543",proto="tcp",real_ip="198.51.100.3",real_port="` + ports[2] + `",status_path="` + statusPath + `",username="UNDEF",virtual_address="10.8.0.14"} 60
+# HELP openvpn_server_connected_clients_by_proto Number of connected clients by transport protocol and address family.
+# TYPE openvpn_server_connected_clients_by_proto gauge
+openvpn_server_connected_clients_by_proto{family="ipv4",proto="tcp",status_path="` + statusPath + `"} 1
+openvpn_server_connected_clients_by_proto{family="ipv4",proto="udp",status_path="` + statusPath + `"} 1
+openvpn_server_connected_clients_by_proto{family="ipv6",proto="udp",status_path="` + statusPath + `"} 1
+`
+		if err := testutil.CollectAndCompare(e, strings.NewReader(expected), "openvpn_server_client_sent_bytes_total", "openvpn_server_connected_clients_by_proto"); err != nil {
+			t.Errorf("ignore real port %t: %s", ignoreRealPort, err)
+		}
+	}
+}
+
+func TestRoutes(t *testing.T) {
+	status := `TITLE	OpenVPN 2.6.12 x86_64-pc-linux-gnu
+TIME	Tue Mar 21 10:39:14 2017	1490089154
+HEADER	CLIENT_LIST	Common Name	Real Address	Virtual Address	Bytes Received	Bytes Sent	Connected Since	Connected Since (time_t)	Username
+CLIENT_LIST	office	198.51.100.1:1194	10.8.0.6	100	900	Thu Mar 16 17:09:03 2017	1489680543	UNDEF
+HEADER	ROUTING_TABLE	Virtual Address	Common Name	Real Address	Last Ref	Last Ref (time_t)
+ROUTING_TABLE	10.8.0.6	office	198.51.100.1:1194	Tue Mar 21 10:26:48 2017	1490088408
+ROUTING_TABLE	10.1.0.0/24	office	198.51.100.1:1194	Tue Mar 21 10:26:48 2017	1490088408
+ROUTING_TABLE	10.1.0.17C	office	198.51.100.1:1194	Tue Mar 21 10:26:50 2017	1490088410
+END
+`
+	statusPath := filepath.Join(t.TempDir(), "server.status")
+	if err := os.WriteFile(statusPath, []byte(status), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	e, err := NewOpenVPNExporter([]string{statusPath}, false, "2.3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `# HELP openvpn_server_client_routed_subnet_info Subnet routed to a client with --iroute.
+# TYPE openvpn_server_client_routed_subnet_info gauge
+openvpn_server_client_routed_subnet_info{common_name="office",status_path="` + statusPath + `",subnet="10.1.0.0/24"} 1
+# HELP openvpn_server_route_last_reference_time_seconds Time at which a route was last referenced, in seconds.
+# TYPE openvpn_server_route_last_reference_time_seconds gauge
+openvpn_server_route_last_reference_time_seconds{common_name="office",proto="",real_ip="198.51.100.1",real_port="1194",status_path="` + statusPath + `",virtual_address="10.1.0.0/24"} 1.490088408e+09
+openvpn_server_route_last_reference_time_seconds{common_name="office",proto="",real_ip="198.51.100.1",real_port="1194",status_path="` + statusPath + `",virtual_address="10.1.0.17"} 1.49008841e+09
+openvpn_server_route_last_reference_time_seconds{common_name="office",proto="",real_ip="198.51.100.1",real_port="1194",status_path="` + statusPath + `",virtual_address="10.8.0.6"} 1.490088408e+09
+# HELP openvpn_server_routes Number of routing table entries by kind: host, subnet, mac or cached.
+# TYPE openvpn_server_routes gauge
+openvpn_server_routes{kind="cached",status_path="` + statusPath + `"} 1
+openvpn_server_routes{kind="host",status_path="` + statusPath + `"} 1
+openvpn_server_routes{kind="mac",status_path="` + statusPath + `"} 0
+openvpn_server_routes{kind="subnet",status_path="` + statusPath + `"} 1
+`
+	if err := testutil.CollectAndCompare(e, strings.NewReader(expected), "openvpn_server_client_routed_subnet_info", "openvpn_server_route_last_reference_time_seconds", "openvpn_server_routes"); err != nil {
+		t.Error(err)
+	}
+}
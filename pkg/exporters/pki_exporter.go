@@ -0,0 +1,322 @@
+package exporters
+
+import (
+	"bufio"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Status flags used in the first column of an easy-rsa index.txt file.
+var pkiIndexStatuses = map[string]string{
+	"V": "valid",
+	"R": "revoked",
+	"E": "expired",
+}
+
+type PKIIndexEntry struct {
+	Status     string
+	Expiry     time.Time
+	Revocation time.Time
+	Serial     string
+	CommonName string
+}
+
+type PKIExporter struct {
+	indexPath      string
+	caPath         string
+	serverCertPath string
+	crlPath        string
+
+	pkiUpDesc                *prometheus.Desc
+	pkiCertificateExpiryDesc *prometheus.Desc
+	pkiCertificatesDesc      *prometheus.Desc
+	pkiCRLRevokedDesc        *prometheus.Desc
+	pkiCRLNextUpdateDesc     *prometheus.Desc
+	pkiCRLThisUpdateDesc     *prometheus.Desc
+}
+
+func NewPKIExporter(indexPath string, caPath string, serverCertPath string, crlPath string) (*PKIExporter, error) {
+	if indexPath == "" && caPath == "" && serverCertPath == "" && crlPath == "" {
+		return nil, fmt.Errorf("at least one PKI file must be configured")
+	}
+	return &PKIExporter{
+		indexPath:      indexPath,
+		caPath:         caPath,
+		serverCertPath: serverCertPath,
+		crlPath:        crlPath,
+		pkiUpDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("openvpn", "pki", "up"),
+			"Whether reading the PKI file was successful.",
+			[]string{"path"}, nil),
+		pkiCertificateExpiryDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("openvpn", "pki", "certificate_expiry_seconds"),
+			"UNIX timestamp at which the certificate expires.",
+			[]string{"common_name", "serial", "status"}, nil),
+		pkiCertificatesDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("openvpn", "pki", "certificates"),
+			"Number of certificates in the easy-rsa index, by status.",
+			[]string{"status"}, nil),
+		pkiCRLRevokedDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("openvpn", "pki", "crl_revoked_certificates"),
+			"Number of certificates listed in the certificate revocation list.",
+			nil, nil),
+		pkiCRLNextUpdateDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("openvpn", "pki", "crl_next_update_time_seconds"),
+			"UNIX timestamp at which the certificate revocation list must be renewed.",
+			nil, nil),
+		pkiCRLThisUpdateDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("openvpn", "pki", "crl_this_update_time_seconds"),
+			"UNIX timestamp at which the certificate revocation list was issued.",
+			nil, nil),
+	}, nil
+}
+
+// Parses the date format used by OpenSSL's ca database, which is an ASN.1
+// UTCTime (YYMMDDHHMMSSZ) or, for dates past 2049, a GeneralizedTime
+// (YYYYMMDDHHMMSSZ).
+func parsePKIIndexTime(value string) (time.Time, error) {
+	if len(value) == len("060102150405Z") {
+		return time.Parse("060102150405Z", value)
+	}
+	return time.Parse("20060102150405Z", value)
+}
+
+// Extracts the common name from a subject in OpenSSL's one-line format,
+// e.g. /C=NL/O=Example/CN=client1/emailAddress=client1@example.com.
+func parsePKISubjectCommonName(subject string) string {
+	for _, part := range strings.Split(subject, "/") {
+		if value, ok := strings.CutPrefix(part, "CN="); ok {
+			return value
+		}
+	}
+	return ""
+}
+
+// Parses an easy-rsa index.txt file. Every line describes a single issued
+// certificate using the tab separated columns status, expiration date,
+// revocation date and reason, serial, file name and subject.
+func parsePKIIndex(file io.Reader) ([]PKIIndexEntry, error) {
+	var entries []PKIIndexEntry
+	scanner := bufio.NewScanner(file)
+	scanner.Split(bufio.ScanLines)
+	for scanner.Scan() {
+		if scanner.Text() == "" {
+			continue
+		}
+		fields := strings.Split(scanner.Text(), "\t")
+		if len(fields) != 6 {
+			return nil, fmt.Errorf("index entry has %d columns instead of 6", len(fields))
+		}
+		status, ok := pkiIndexStatuses[fields[0]]
+		if !ok {
+			return nil, fmt.Errorf("unsupported certificate status: %q", fields[0])
+		}
+		expiry, err := parsePKIIndexTime(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse expiration date: %v", err)
+		}
+		entry := PKIIndexEntry{
+			Status:     status,
+			Expiry:     expiry,
+			Serial:     strings.ToLower(fields[3]),
+			CommonName: parsePKISubjectCommonName(fields[5]),
+		}
+		if fields[2] != "" {
+			// The revocation date may be followed by a reason.
+			revocation, _, _ := strings.Cut(fields[2], ",")
+			entry.Revocation, err = parsePKIIndexTime(revocation)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse revocation date: %v", err)
+			}
+		}
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
+
+// Reads a file containing either a PEM or a DER encoded object of the given
+// PEM block type, returning the DER contents of the first matching block.
+func readPEMOrDER(path string, blockType string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	rest := data
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type == blockType {
+			return block.Bytes, nil
+		}
+	}
+	if len(data) > 0 && data[0] == 0x30 {
+		// Looks like an ASN.1 sequence, so assume DER.
+		return data, nil
+	}
+	return nil, fmt.Errorf("no %s found in %s", blockType, path)
+}
+
+func (e *PKIExporter) collectIndex(ch chan<- prometheus.Metric, seenSerials map[string]bool) error {
+	file, err := os.Open(e.indexPath)
+	if err != nil {
+		return fmt.Errorf("failed to open index file %s: %s", e.indexPath, err)
+	}
+	defer file.Close()
+	entries, err := parsePKIIndex(file)
+	if err != nil {
+		return fmt.Errorf("failed to parse index file %s: %s", e.indexPath, err)
+	}
+
+	counts := map[string]int{}
+	for _, status := range pkiIndexStatuses {
+		counts[status] = 0
+	}
+	for _, entry := range entries {
+		counts[entry.Status]++
+		if seenSerials[entry.Serial] {
+			// Renewed certificates can show up more than once.
+			slog.Warn("Duplicate serial in PKI index, skipping it", "path", e.indexPath, "serial", entry.Serial)
+			continue
+		}
+		seenSerials[entry.Serial] = true
+		if err := sendMetric(ch,
+			e.pkiCertificateExpiryDesc,
+			prometheus.GaugeValue,
+			float64(entry.Expiry.Unix()),
+			entry.CommonName,
+			entry.Serial,
+			entry.Status); err != nil {
+			return err
+		}
+	}
+	for status, count := range counts {
+		if err := sendMetric(ch,
+			e.pkiCertificatesDesc,
+			prometheus.GaugeValue,
+			float64(count),
+			status); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *PKIExporter) collectCertificate(path string, ch chan<- prometheus.Metric, seenSerials map[string]bool) error {
+	der, err := readPEMOrDER(path, "CERTIFICATE")
+	if err != nil {
+		return fmt.Errorf("failed to read certificate: %s", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return fmt.Errorf("failed to parse certificate %s: %s", path, err)
+	}
+	serial := fmt.Sprintf("%x", cert.SerialNumber)
+	if len(serial)%2 == 1 {
+		// OpenSSL writes serials as an even number of hex digits.
+		serial = "0" + serial
+	}
+	if seenSerials[serial] {
+		// Already exported from the index, with its recorded status.
+		return nil
+	}
+	seenSerials[serial] = true
+	status := "valid"
+	if time.Now().After(cert.NotAfter) {
+		status = "expired"
+	}
+	if err := sendMetric(ch,
+		e.pkiCertificateExpiryDesc,
+		prometheus.GaugeValue,
+		float64(cert.NotAfter.Unix()),
+		cert.Subject.CommonName,
+		serial,
+		status); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (e *PKIExporter) collectCRL(ch chan<- prometheus.Metric) error {
+	der, err := readPEMOrDER(e.crlPath, "X509 CRL")
+	if err != nil {
+		return fmt.Errorf("failed to read CRL: %s", err)
+	}
+	crl, err := x509.ParseRevocationList(der)
+	if err != nil {
+		return fmt.Errorf("failed to parse CRL %s: %s", e.crlPath, err)
+	}
+	if err := sendMetric(ch,
+		e.pkiCRLRevokedDesc,
+		prometheus.GaugeValue,
+		float64(len(crl.RevokedCertificateEntries))); err != nil {
+		return err
+	}
+	if err := sendMetric(ch,
+		e.pkiCRLThisUpdateDesc,
+		prometheus.GaugeValue,
+		float64(crl.ThisUpdate.Unix())); err != nil {
+		return err
+	}
+	// The next update is optional, and CRLs lacking it have no deadline
+	// to export.
+	if crl.NextUpdate.IsZero() {
+		return nil
+	}
+	if err := sendMetric(ch,
+		e.pkiCRLNextUpdateDesc,
+		prometheus.GaugeValue,
+		float64(crl.NextUpdate.Unix())); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (e *PKIExporter) Describe(ch chan<- *prometheus.Desc) {
+	ch <- e.pkiUpDesc
+	ch <- e.pkiCertificateExpiryDesc
+	ch <- e.pkiCertificatesDesc
+	ch <- e.pkiCRLRevokedDesc
+	ch <- e.pkiCRLNextUpdateDesc
+	ch <- e.pkiCRLThisUpdateDesc
+}
+
+func (e *PKIExporter) Collect(ch chan<- prometheus.Metric) {
+	// The index is read first, so that certificates it lists are exported
+	// with their recorded status rather than one derived from the file.
+	seenSerials := map[string]bool{}
+	sources := []struct {
+		path    string
+		collect func() error
+	}{
+		{e.indexPath, func() error { return e.collectIndex(ch, seenSerials) }},
+		{e.caPath, func() error { return e.collectCertificate(e.caPath, ch, seenSerials) }},
+		{e.serverCertPath, func() error { return e.collectCertificate(e.serverCertPath, ch, seenSerials) }},
+		{e.crlPath, func() error { return e.collectCRL(ch) }},
+	}
+	for _, source := range sources {
+		if source.path == "" {
+			continue
+		}
+		up := 1.0
+		if err := source.collect(); err != nil {
+			slog.Warn("Failed to read PKI file", "path", source.path, "err", err)
+			up = 0.0
+		}
+		ch <- prometheus.MustNewConstMetric(
+			e.pkiUpDesc,
+			prometheus.GaugeValue,
+			up,
+			source.path)
+	}
+}
@@ -0,0 +1,174 @@
+package exporters
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+const testPKIIndex = "V\t340101000000Z\t\t01\tunknown\t/CN=server\n" +
+	"R\t340101000000Z\t240301120000Z,keyCompromise\t02\tunknown\t/C=NL/CN=client1/emailAddress=client1@example.com\n" +
+	"E\t230101000000Z\t\t0A\tunknown\t/CN=client2\n"
+
+func TestParsePKIIndex(t *testing.T) {
+	entries, err := parsePKIIndex(strings.NewReader(testPKIIndex))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("expected 3 entries, got %d", len(entries))
+	}
+	if entries[1].CommonName != "client1" || entries[1].Status != "revoked" {
+		t.Errorf("unexpected entry: %+v", entries[1])
+	}
+	if want := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC); !entries[1].Revocation.Equal(want) {
+		t.Errorf("expected revocation at %s, got %s", want, entries[1].Revocation)
+	}
+	if entries[2].Serial != "0a" {
+		t.Errorf("expected serial 0a, got %s", entries[2].Serial)
+	}
+
+	if _, err := parsePKIIndex(strings.NewReader("X\t340101000000Z\t\t01\tunknown\t/CN=server\n")); err == nil {
+		t.Error("expected error for unknown status")
+	}
+}
+
+func TestPKIExporterCollect(t *testing.T) {
+	dir := t.TempDir()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	notAfter := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(0xff),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              notAfter,
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	crl, err := x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+		Number:     big.NewInt(1),
+		ThisUpdate: time.Unix(1700000000, 0),
+		NextUpdate: time.Unix(1800000000, 0),
+		RevokedCertificateEntries: []x509.RevocationListEntry{
+			{SerialNumber: big.NewInt(2), RevocationTime: time.Unix(1709294400, 0)},
+		},
+	}, ca, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	indexPath := filepath.Join(dir, "index.txt")
+	caPath := filepath.Join(dir, "ca.crt")
+	crlPath := filepath.Join(dir, "crl.pem")
+	for path, data := range map[string][]byte{
+		indexPath: []byte(testPKIIndex),
+		caPath:    pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		crlPath:   pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: crl}),
+	} {
+		if err := os.WriteFile(path, data, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	exporter, err := NewPKIExporter(indexPath, caPath, "", crlPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `
+# HELP openvpn_pki_certificate_expiry_seconds UNIX timestamp at which the certificate expires.
+# TYPE openvpn_pki_certificate_expiry_seconds gauge
+openvpn_pki_certificate_expiry_seconds{common_name="Test CA",serial="ff",status="valid"} 1.893456e+09
+openvpn_pki_certificate_expiry_seconds{common_name="client1",serial="02",status="revoked"} 2.0196864e+09
+openvpn_pki_certificate_expiry_seconds{common_name="client2",serial="0a",status="expired"} 1.6725312e+09
+openvpn_pki_certificate_expiry_seconds{common_name="server",serial="01",status="valid"} 2.0196864e+09
+# HELP openvpn_pki_crl_next_update_time_seconds UNIX timestamp at which the certificate revocation list must be renewed.
+# TYPE openvpn_pki_crl_next_update_time_seconds gauge
+openvpn_pki_crl_next_update_time_seconds 1.8e+09
+# HELP openvpn_pki_crl_revoked_certificates Number of certificates listed in the certificate revocation list.
+# TYPE openvpn_pki_crl_revoked_certificates gauge
+openvpn_pki_crl_revoked_certificates 1
+`
+	if err := testutil.CollectAndCompare(exporter, strings.NewReader(expected),
+		"openvpn_pki_certificate_expiry_seconds",
+		"openvpn_pki_crl_next_update_time_seconds",
+		"openvpn_pki_crl_revoked_certificates"); err != nil {
+		t.Error(err)
+	}
+}
+
+// The next update of CRLs is optional, and cannot be left out with
+// x509.CreateRevocationList, so the CRL is encoded by hand. It is not
+// verified, so its signature is left empty.
+func TestPKIExporterCRLWithoutNextUpdate(t *testing.T) {
+	issuer, err := asn1.Marshal(pkix.Name{CommonName: "Test CA"}.ToRDNSequence())
+	if err != nil {
+		t.Fatal(err)
+	}
+	algorithm := pkix.AlgorithmIdentifier{Algorithm: asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}}
+	type tbsCertList struct {
+		Version    int
+		Signature  pkix.AlgorithmIdentifier
+		Issuer     asn1.RawValue
+		ThisUpdate time.Time `asn1:"utc"`
+	}
+	crl, err := asn1.Marshal(struct {
+		TBSCertList        tbsCertList
+		SignatureAlgorithm pkix.AlgorithmIdentifier
+		SignatureValue     asn1.BitString
+	}{
+		TBSCertList:        tbsCertList{1, algorithm, asn1.RawValue{FullBytes: issuer}, time.Unix(1700000000, 0).UTC()},
+		SignatureAlgorithm: algorithm,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	crlPath := filepath.Join(t.TempDir(), "crl.pem")
+	if err := os.WriteFile(crlPath, pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: crl}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	exporter, err := NewPKIExporter("", "", "", crlPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `
+# HELP openvpn_pki_crl_revoked_certificates Number of certificates listed in the certificate revocation list.
+# TYPE openvpn_pki_crl_revoked_certificates gauge
+openvpn_pki_crl_revoked_certificates 0
+# HELP openvpn_pki_crl_this_update_time_seconds UNIX timestamp at which the certificate revocation list was issued.
+# TYPE openvpn_pki_crl_this_update_time_seconds gauge
+openvpn_pki_crl_this_update_time_seconds 1.7e+09
+`
+	if err := testutil.CollectAndCompare(exporter, strings.NewReader(expected),
+		"openvpn_pki_crl_revoked_certificates",
+		"openvpn_pki_crl_this_update_time_seconds"); err != nil {
+		t.Error(err)
+	}
+	if count := testutil.CollectAndCount(exporter, "openvpn_pki_crl_next_update_time_seconds"); count != 0 {
+		t.Errorf("expected no next update to be exported, got %d metrics", count)
+	}
+}
@@ -0,0 +1,62 @@
+package formats
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+const (
+	Prometheus = "prometheus"
+	Influx     = "influx"
+	Graphite   = "graphite"
+)
+
+func IsValidFormat(format string) bool {
+	return format == Prometheus || format == Influx || format == Graphite
+}
+
+// Encodes metric families in the given format. The prefix is only used
+// for Graphite, whose metric names are commonly namespaced per host.
+func Encode(out io.Writer, format string, families []*dto.MetricFamily, prefix string, timestamp time.Time) error {
+	switch format {
+	case Prometheus:
+		encoder := expfmt.NewEncoder(out, expfmt.NewFormat(expfmt.TypeTextPlain))
+		for _, family := range families {
+			if err := encoder.Encode(family); err != nil {
+				return err
+			}
+		}
+		return nil
+	case Influx:
+		return WriteInflux(out, families, timestamp)
+	case Graphite:
+		return WriteGraphite(out, families, prefix, timestamp)
+	}
+	return fmt.Errorf("unknown format %q", format)
+}
+
+// Returns a handler serving the gathered metrics in the given format,
+// e.g. for Telegraf's http input with data_format = "influx".
+func Handler(gatherer prometheus.Gatherer, format string, prefix string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		families, err := gatherer.Gather()
+		if err != nil && len(families) == 0 {
+			http.Error(w, fmt.Sprintf("failed to gather metrics: %s", err), http.StatusInternalServerError)
+			return
+		}
+		var body bytes.Buffer
+		if err := Encode(&body, format, families, prefix, time.Now()); err != nil {
+			http.Error(w, fmt.Sprintf("failed to encode metrics: %s", err), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		_, _ = w.Write(body.Bytes())
+	})
+}
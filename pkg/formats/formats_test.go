@@ -0,0 +1,152 @@
+package formats
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func testRegistry() *prometheus.Registry {
+	registry := prometheus.NewRegistry()
+	bytesReceived := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "openvpn_server_client_received_bytes_total",
+		Help: "Amount of data received over a connection on the VPN server, in bytes.",
+	}, []string{"status_path", "common_name", "username"})
+	bytesReceived.WithLabelValues("/run/server.status", "Jane Doe, laptop", "").Add(1024)
+	up := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "openvpn_up", Help: "Up."}, []string{"status_path"})
+	up.WithLabelValues("/run/server.status").Set(1)
+	summary := prometheus.NewSummary(prometheus.SummaryOpts{Name: "scrape_seconds", Help: "Scrape duration.", Objectives: map[float64]float64{0.5: 0.05}})
+	summary.Observe(2)
+	registry.MustRegister(bytesReceived, up, summary)
+	return registry
+}
+
+func TestWriteInflux(t *testing.T) {
+	families, err := testRegistry().Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if err := WriteInflux(&out, families, time.Unix(1700000000, 0)); err != nil {
+		t.Fatal(err)
+	}
+	expected := `openvpn_server_client_received_bytes_total,common_name=Jane\ Doe\,\ laptop,status_path=/run/server.status counter=1024 1700000000000000000
+openvpn_up,status_path=/run/server.status gauge=1 1700000000000000000
+scrape_seconds sum=2,count=1,0.5=2 1700000000000000000
+`
+	if out.String() != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, out.String())
+	}
+}
+
+func TestWriteInfluxLineBreaks(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	up := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "openvpn_client_up", Help: "Up."}, []string{"common_name"})
+	up.WithLabelValues("Jane\r\nDoe\n").Set(1)
+	registry.MustRegister(up)
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if err := WriteInflux(&out, families, time.Unix(1700000000, 0)); err != nil {
+		t.Fatal(err)
+	}
+	expected := `openvpn_client_up,common_name=Jane\ \ Doe\  gauge=1 1700000000000000000
+`
+	if out.String() != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, out.String())
+	}
+}
+
+func TestWriteGraphite(t *testing.T) {
+	families, err := testRegistry().Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if err := WriteGraphite(&out, families, "vpn.", time.Unix(1700000000, 0)); err != nil {
+		t.Fatal(err)
+	}
+	expected := `vpn.openvpn_server_client_received_bytes_total;common_name=Jane_Doe,_laptop;status_path=/run/server.status 1024 1700000000
+vpn.openvpn_up;status_path=/run/server.status 1 1700000000
+vpn.scrape_seconds;quantile=0.5 2 1700000000
+vpn.scrape_seconds_sum 2 1700000000
+vpn.scrape_seconds_count 1 1700000000
+`
+	if out.String() != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, out.String())
+	}
+}
+
+func TestSenderUDP(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	sender, err := NewSender(SenderConfig{
+		URL:     "udp://" + conn.LocalAddr().String(),
+		Format:  Graphite,
+		Timeout: time.Second,
+	}, testRegistry())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sender.Send(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := make([]byte, maxDatagramSize)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Count(string(buf[:n]), "\n"); lines != 5 {
+		t.Errorf("expected 5 lines in datagram, got %d: %s", lines, buf[:n])
+	}
+}
+
+func TestSenderUDPUnterminatedLine(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	sender, err := NewSender(SenderConfig{
+		URL:     "udp://" + conn.LocalAddr().String(),
+		Format:  Graphite,
+		Timeout: time.Second,
+	}, testRegistry())
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := "vpn.up 1 1700000000\nvpn.clients 2 1700000000"
+	if err := sender.sendUDP(context.Background(), []byte(body)); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := make([]byte, maxDatagramSize)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(buf[:n]) != body {
+		t.Errorf("expected datagram %q, got %q", body, buf[:n])
+	}
+}
+
+func TestNewSenderRejectsGraphiteOverHTTP(t *testing.T) {
+	if _, err := NewSender(SenderConfig{URL: "http://localhost:2003", Format: Graphite}, testRegistry()); err == nil {
+		t.Error("expected an error")
+	}
+}
@@ -0,0 +1,91 @@
+package formats
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+// Characters that are not allowed in Graphite tags, or would break up a
+// line of the plaintext protocol.
+var graphiteTagEscaper = strings.NewReplacer(";", "_", "!", "_", "^", "_", "=", "_", " ", "_", "\t", "_", "\n", "_", "~", "_")
+
+func writeGraphiteLine(w *bufio.Writer, prefix string, name string, tags []*dto.LabelPair, extraTag *dto.LabelPair, value float64, timestamp time.Time) {
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return
+	}
+	w.WriteString(prefix)
+	w.WriteString(graphiteTagEscaper.Replace(name))
+	if extraTag != nil {
+		tags = append(tags[:len(tags):len(tags)], extraTag)
+	}
+	for _, tag := range tags {
+		if tag.GetValue() == "" {
+			// Graphite does not accept empty tag values.
+			continue
+		}
+		w.WriteByte(';')
+		w.WriteString(graphiteTagEscaper.Replace(tag.GetName()))
+		w.WriteByte('=')
+		w.WriteString(graphiteTagEscaper.Replace(tag.GetValue()))
+	}
+	w.WriteByte(' ')
+	w.WriteString(strconv.FormatFloat(value, 'g', -1, 64))
+	w.WriteByte(' ')
+	w.WriteString(strconv.FormatInt(timestamp.Unix(), 10))
+	w.WriteByte('\n')
+}
+
+// Renders metric families in Graphite's plaintext protocol, using tagged
+// series (name;tag=value) with the labels as tags. Summaries and
+// histograms are expanded in the same way as in Prometheus' text format.
+func WriteGraphite(out io.Writer, families []*dto.MetricFamily, prefix string, timestamp time.Time) error {
+	w := bufio.NewWriter(out)
+	for _, family := range families {
+		name := family.GetName()
+		for _, metric := range family.Metric {
+			ts := timestamp
+			if metric.TimestampMs != nil {
+				ts = time.UnixMilli(metric.GetTimestampMs())
+			}
+			switch family.GetType() {
+			case dto.MetricType_COUNTER:
+				writeGraphiteLine(w, prefix, name, metric.Label, nil, metric.GetCounter().GetValue(), ts)
+			case dto.MetricType_GAUGE:
+				writeGraphiteLine(w, prefix, name, metric.Label, nil, metric.GetGauge().GetValue(), ts)
+			case dto.MetricType_UNTYPED:
+				writeGraphiteLine(w, prefix, name, metric.Label, nil, metric.GetUntyped().GetValue(), ts)
+			case dto.MetricType_SUMMARY:
+				summary := metric.GetSummary()
+				for _, quantile := range summary.Quantile {
+					tag := &dto.LabelPair{Name: stringPtr("quantile"), Value: stringPtr(strconv.FormatFloat(quantile.GetQuantile(), 'g', -1, 64))}
+					writeGraphiteLine(w, prefix, name, metric.Label, tag, quantile.GetValue(), ts)
+				}
+				writeGraphiteLine(w, prefix, name+"_sum", metric.Label, nil, summary.GetSampleSum(), ts)
+				writeGraphiteLine(w, prefix, name+"_count", metric.Label, nil, float64(summary.GetSampleCount()), ts)
+			case dto.MetricType_HISTOGRAM:
+				histogram := metric.GetHistogram()
+				for _, bucket := range histogram.Bucket {
+					if !math.IsInf(bucket.GetUpperBound(), 1) {
+						tag := &dto.LabelPair{Name: stringPtr("le"), Value: stringPtr(strconv.FormatFloat(bucket.GetUpperBound(), 'g', -1, 64))}
+						writeGraphiteLine(w, prefix, name+"_bucket", metric.Label, tag, float64(bucket.GetCumulativeCount()), ts)
+					}
+				}
+				tag := &dto.LabelPair{Name: stringPtr("le"), Value: stringPtr("+Inf")}
+				writeGraphiteLine(w, prefix, name+"_bucket", metric.Label, tag, float64(histogram.GetSampleCount()), ts)
+				writeGraphiteLine(w, prefix, name+"_sum", metric.Label, nil, histogram.GetSampleSum(), ts)
+				writeGraphiteLine(w, prefix, name+"_count", metric.Label, nil, float64(histogram.GetSampleCount()), ts)
+			}
+		}
+	}
+	return w.Flush()
+}
+
+func stringPtr(s string) *string {
+	return &s
+}
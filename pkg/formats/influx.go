@@ -0,0 +1,112 @@
+package formats
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+// Line protocol cannot escape line breaks, so they are replaced by escaped
+// spaces.
+var (
+	influxMeasurementEscaper = strings.NewReplacer(",", `\,`, " ", `\ `, "\r", `\ `, "\n", `\ `)
+	influxTagEscaper         = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `, "\r", `\ `, "\n", `\ `)
+)
+
+type influxField struct {
+	name  string
+	value float64
+}
+
+func writeInfluxLine(w *bufio.Writer, measurement string, tags []*dto.LabelPair, fields []influxField, timestamp time.Time) {
+	var validFields []influxField
+	for _, field := range fields {
+		// Line protocol has no representation for these.
+		if !math.IsNaN(field.value) && !math.IsInf(field.value, 0) {
+			validFields = append(validFields, field)
+		}
+	}
+	if len(validFields) == 0 {
+		return
+	}
+
+	w.WriteString(influxMeasurementEscaper.Replace(measurement))
+	// Tags are sorted by key, which is what InfluxDB prefers.
+	var keys []string
+	values := map[string]string{}
+	for _, tag := range tags {
+		keys = append(keys, tag.GetName())
+		values[tag.GetName()] = tag.GetValue()
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if values[key] == "" {
+			continue
+		}
+		w.WriteByte(',')
+		w.WriteString(influxTagEscaper.Replace(key))
+		w.WriteByte('=')
+		w.WriteString(influxTagEscaper.Replace(values[key]))
+	}
+	for i, field := range validFields {
+		if i == 0 {
+			w.WriteByte(' ')
+		} else {
+			w.WriteByte(',')
+		}
+		w.WriteString(influxTagEscaper.Replace(field.name))
+		w.WriteByte('=')
+		w.WriteString(strconv.FormatFloat(field.value, 'g', -1, 64))
+	}
+	w.WriteByte(' ')
+	w.WriteString(strconv.FormatInt(timestamp.UnixNano(), 10))
+	w.WriteByte('\n')
+}
+
+// Renders metric families as InfluxDB line protocol, using the same
+// mapping as Telegraf's prometheus input with metric_version = 1: the
+// metric name becomes the measurement, labels become tags, and the value
+// is stored in a field named after the metric type.
+func WriteInflux(out io.Writer, families []*dto.MetricFamily, timestamp time.Time) error {
+	w := bufio.NewWriter(out)
+	for _, family := range families {
+		for _, metric := range family.Metric {
+			ts := timestamp
+			if metric.TimestampMs != nil {
+				ts = time.UnixMilli(metric.GetTimestampMs())
+			}
+			switch family.GetType() {
+			case dto.MetricType_COUNTER:
+				writeInfluxLine(w, family.GetName(), metric.Label, []influxField{{"counter", metric.GetCounter().GetValue()}}, ts)
+			case dto.MetricType_GAUGE:
+				writeInfluxLine(w, family.GetName(), metric.Label, []influxField{{"gauge", metric.GetGauge().GetValue()}}, ts)
+			case dto.MetricType_UNTYPED:
+				writeInfluxLine(w, family.GetName(), metric.Label, []influxField{{"value", metric.GetUntyped().GetValue()}}, ts)
+			case dto.MetricType_SUMMARY:
+				summary := metric.GetSummary()
+				fields := []influxField{{"sum", summary.GetSampleSum()}, {"count", float64(summary.GetSampleCount())}}
+				for _, quantile := range summary.Quantile {
+					fields = append(fields, influxField{strconv.FormatFloat(quantile.GetQuantile(), 'g', -1, 64), quantile.GetValue()})
+				}
+				writeInfluxLine(w, family.GetName(), metric.Label, fields, ts)
+			case dto.MetricType_HISTOGRAM:
+				histogram := metric.GetHistogram()
+				fields := []influxField{{"sum", histogram.GetSampleSum()}, {"count", float64(histogram.GetSampleCount())}}
+				for _, bucket := range histogram.Bucket {
+					if !math.IsInf(bucket.GetUpperBound(), 1) {
+						fields = append(fields, influxField{strconv.FormatFloat(bucket.GetUpperBound(), 'g', -1, 64), float64(bucket.GetCumulativeCount())})
+					}
+				}
+				fields = append(fields, influxField{"+Inf", float64(histogram.GetSampleCount())})
+				writeInfluxLine(w, family.GetName(), metric.Label, fields, ts)
+			}
+		}
+	}
+	return w.Flush()
+}
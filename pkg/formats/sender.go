@@ -0,0 +1,188 @@
+package formats
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Maximum size of a UDP datagram, chosen to avoid fragmentation on
+// common networks. Lines are never split across datagrams.
+const maxDatagramSize = 1400
+
+type SenderConfig struct {
+	// Where to send metrics to: an http(s) URL, such as the write
+	// endpoint of InfluxDB, or a udp:// or tcp:// address.
+	URL      string
+	Format   string
+	Prefix   string
+	Interval time.Duration
+	Timeout  time.Duration
+	// File containing a token sent in an Authorization header with HTTP
+	// requests, as used by InfluxDB 2.
+	TokenFile string
+}
+
+// Periodically sends the gathered metrics in InfluxDB line protocol or
+// Graphite plaintext format, to an HTTP endpoint or over UDP or TCP.
+type Sender struct {
+	config   SenderConfig
+	gatherer prometheus.Gatherer
+	url      *url.URL
+	client   *http.Client
+}
+
+func NewSender(config SenderConfig, gatherer prometheus.Gatherer) (*Sender, error) {
+	if config.Format != Influx && config.Format != Graphite {
+		return nil, fmt.Errorf("unsupported format %q", config.Format)
+	}
+	u, err := url.Parse(config.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid URL: %s", err)
+	}
+	switch u.Scheme {
+	case "http", "https":
+		if config.Format == Graphite {
+			return nil, fmt.Errorf("Graphite does not accept metrics over HTTP")
+		}
+	case "udp", "tcp":
+		if u.Host == "" {
+			return nil, fmt.Errorf("no host in URL %q", config.URL)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported URL scheme %q", u.Scheme)
+	}
+	return &Sender{
+		config:   config,
+		gatherer: gatherer,
+		url:      u,
+		client:   &http.Client{Timeout: config.Timeout},
+	}, nil
+}
+
+// Gathers all metrics and sends them once.
+func (s *Sender) Send(ctx context.Context) error {
+	families, err := s.gatherer.Gather()
+	if err != nil && len(families) == 0 {
+		return fmt.Errorf("failed to gather metrics: %s", err)
+	}
+	var body bytes.Buffer
+	if err := Encode(&body, s.config.Format, families, s.config.Prefix, time.Now()); err != nil {
+		return fmt.Errorf("failed to encode metrics: %s", err)
+	}
+	if body.Len() == 0 {
+		return nil
+	}
+	switch s.url.Scheme {
+	case "udp":
+		return s.sendUDP(ctx, body.Bytes())
+	case "tcp":
+		return s.sendTCP(ctx, body.Bytes())
+	}
+	return s.sendHTTP(ctx, body.Bytes())
+}
+
+func (s *Sender) sendHTTP(ctx context.Context, body []byte) error {
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, s.config.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	request.Header.Set("User-Agent", "openvpn_exporter")
+	if s.config.TokenFile != "" {
+		token, err := os.ReadFile(s.config.TokenFile)
+		if err != nil {
+			return fmt.Errorf("failed to read token: %s", err)
+		}
+		request.Header.Set("Authorization", "Token "+strings.TrimSpace(string(token)))
+	}
+	response, err := s.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode/100 != 2 {
+		responseBody, _ := io.ReadAll(io.LimitReader(response.Body, 512))
+		return fmt.Errorf("server returned %s: %s", response.Status, bytes.TrimSpace(responseBody))
+	}
+	_, _ = io.Copy(io.Discard, response.Body)
+	return nil
+}
+
+func (s *Sender) dial(ctx context.Context) (net.Conn, error) {
+	dialer := net.Dialer{Timeout: s.config.Timeout}
+	conn, err := dialer.DialContext(ctx, s.url.Scheme, s.url.Host)
+	if err != nil {
+		return nil, err
+	}
+	if s.config.Timeout > 0 {
+		conn.SetDeadline(time.Now().Add(s.config.Timeout))
+	}
+	return conn, nil
+}
+
+// Sends lines over UDP, packing as many as fit into every datagram.
+func (s *Sender) sendUDP(ctx context.Context, body []byte) error {
+	conn, err := s.dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	for len(body) > 0 {
+		end := 0
+		for end < len(body) {
+			// An unterminated last line is sent as it is.
+			next := len(body)
+			if i := bytes.IndexByte(body[end:], '\n'); i >= 0 {
+				next = end + i + 1
+			}
+			if end > 0 && next > maxDatagramSize {
+				break
+			}
+			end = next
+		}
+		if _, err := conn.Write(body[:end]); err != nil {
+			return err
+		}
+		body = body[end:]
+	}
+	return nil
+}
+
+func (s *Sender) sendTCP(ctx context.Context, body []byte) error {
+	conn, err := s.dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = conn.Write(body)
+	return err
+}
+
+// Sends metrics at the configured interval until the context is
+// cancelled. Failed sends are not retried, as the next interval brings
+// fresh values.
+func (s *Sender) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.config.Interval)
+	defer ticker.Stop()
+	for {
+		if err := s.Send(ctx); err != nil && ctx.Err() == nil {
+			slog.Warn("Failed to send metrics", "format", s.config.Format, "url", s.config.URL, "err", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
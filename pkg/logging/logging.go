@@ -0,0 +1,134 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Creates a logger writing in logfmt or JSON format, dropping records
+// below the given level. Records repeating within the rate limit interval
+// are suppressed, unless the interval is zero.
+func New(out io.Writer, level string, format string, rateLimitInterval time.Duration) (*slog.Logger, error) {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("invalid log level %q, supported levels are debug, info, warn and error", level)
+	}
+	options := &slog.HandlerOptions{Level: l}
+	var handler slog.Handler
+	switch format {
+	case "logfmt":
+		handler = slog.NewTextHandler(out, options)
+	case "json":
+		handler = slog.NewJSONHandler(out, options)
+	default:
+		return nil, fmt.Errorf("invalid log format %q, supported formats are logfmt and json", format)
+	}
+	if rateLimitInterval > 0 {
+		handler = NewRateLimitHandler(handler, rateLimitInterval)
+	}
+	return slog.New(handler), nil
+}
+
+type rateLimitEntry struct {
+	lastLogged time.Time
+	suppressed int
+}
+
+// State shared by a rate limiting handler and those derived from it.
+type rateLimitState struct {
+	mu       sync.Mutex
+	interval time.Duration
+	entries  map[string]*rateLimitEntry
+	now      func() time.Time
+}
+
+// Handler passing on a record only if no identical record, with the same
+// level, message and attributes, was passed on within the interval.
+// Such records, e.g. warnings about the same malformed status file on
+// every scrape, would otherwise flood the log. Once a record is passed on
+// again, it carries the number of copies suppressed in between.
+type RateLimitHandler struct {
+	next   slog.Handler
+	state  *rateLimitState
+	prefix string
+}
+
+func NewRateLimitHandler(next slog.Handler, interval time.Duration) *RateLimitHandler {
+	return &RateLimitHandler{
+		next: next,
+		state: &rateLimitState{
+			interval: interval,
+			entries:  map[string]*rateLimitEntry{},
+			now:      time.Now,
+		},
+	}
+}
+
+func (h *RateLimitHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+// Returns a string identifying records that are considered identical.
+func (h *RateLimitHandler) key(record slog.Record) string {
+	var key strings.Builder
+	key.WriteString(h.prefix)
+	key.WriteString(record.Level.String())
+	key.WriteByte(0)
+	key.WriteString(record.Message)
+	record.Attrs(func(attr slog.Attr) bool {
+		key.WriteByte(0)
+		key.WriteString(attr.String())
+		return true
+	})
+	return key.String()
+}
+
+func (h *RateLimitHandler) Handle(ctx context.Context, record slog.Record) error {
+	key := h.key(record)
+	s := h.state
+	s.mu.Lock()
+	now := s.now()
+	entry, ok := s.entries[key]
+	if ok && now.Sub(entry.lastLogged) < s.interval {
+		entry.suppressed++
+		s.mu.Unlock()
+		return nil
+	}
+	suppressed := 0
+	if ok {
+		suppressed = entry.suppressed
+	} else {
+		// Forget records that have not been seen for a while, so that
+		// the number of entries stays bounded.
+		for k, e := range s.entries {
+			if now.Sub(e.lastLogged) >= s.interval && e.suppressed == 0 {
+				delete(s.entries, k)
+			}
+		}
+	}
+	s.entries[key] = &rateLimitEntry{lastLogged: now}
+	s.mu.Unlock()
+
+	if suppressed > 0 {
+		record = record.Clone()
+		record.AddAttrs(slog.Int("suppressed", suppressed))
+	}
+	return h.next.Handle(ctx, record)
+}
+
+func (h *RateLimitHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	prefix := h.prefix
+	for _, attr := range attrs {
+		prefix += attr.String() + "\x00"
+	}
+	return &RateLimitHandler{next: h.next.WithAttrs(attrs), state: h.state, prefix: prefix}
+}
+
+func (h *RateLimitHandler) WithGroup(name string) slog.Handler {
+	return &RateLimitHandler{next: h.next.WithGroup(name), state: h.state, prefix: h.prefix + name + ".\x00"}
+}
@@ -0,0 +1,61 @@
+package logging
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRateLimitHandler(t *testing.T) {
+	var out bytes.Buffer
+	handler := NewRateLimitHandler(slog.NewTextHandler(&out, &slog.HandlerOptions{
+		ReplaceAttr: func(_ []string, attr slog.Attr) slog.Attr {
+			if attr.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+			return attr
+		},
+	}), time.Minute)
+	now := time.Unix(0, 0)
+	handler.state.now = func() time.Time { return now }
+	logger := slog.New(handler).With("status_path", "/run/server.status")
+
+	for i := 0; i < 3; i++ {
+		logger.Warn("Duplicate entry", "common_name", "alice")
+	}
+	logger.Warn("Duplicate entry", "common_name", "bob")
+	slog.New(handler).Warn("Duplicate entry", "common_name", "alice")
+	now = now.Add(time.Minute)
+	logger.Warn("Duplicate entry", "common_name", "alice")
+
+	expected := []string{
+		`level=WARN msg="Duplicate entry" status_path=/run/server.status common_name=alice`,
+		`level=WARN msg="Duplicate entry" status_path=/run/server.status common_name=bob`,
+		`level=WARN msg="Duplicate entry" common_name=alice`,
+		`level=WARN msg="Duplicate entry" status_path=/run/server.status common_name=alice suppressed=2`,
+	}
+	if lines := strings.Split(strings.TrimSpace(out.String()), "\n"); strings.Join(lines, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expected:\n%s\ngot:\n%s", strings.Join(expected, "\n"), out.String())
+	}
+}
+
+func TestNew(t *testing.T) {
+	var out bytes.Buffer
+	logger, err := New(&out, "warn", "json", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger.Info("Dropped")
+	logger.Warn("Kept", "status_path", "/run/server.status")
+	if !strings.Contains(out.String(), `"msg":"Kept","status_path":"/run/server.status"`) || strings.Contains(out.String(), "Dropped") {
+		t.Errorf("unexpected output %s", out.String())
+	}
+	if _, err := New(&out, "verbose", "logfmt", 0); err == nil {
+		t.Error("expected an error for an invalid level")
+	}
+	if _, err := New(&out, "info", "xml", 0); err == nil {
+		t.Error("expected an error for an invalid format")
+	}
+}
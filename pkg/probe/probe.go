@@ -0,0 +1,136 @@
+package probe
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/kumina/openvpn_exporter/pkg/config"
+	"github.com/kumina/openvpn_exporter/pkg/exporters"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// Serves /probe requests, which export the metrics of a single status
+// file or management interface chosen by the caller, in the same way as
+// the blackbox exporter. This allows a central exporter to be driven by
+// Prometheus service discovery.
+type Handler struct {
+	allowedTargets []*regexp.Regexp
+	modules        map[string]config.ModuleConfig
+}
+
+func NewHandler(c config.ProbeConfig) (*Handler, error) {
+	h := &Handler{modules: c.Modules}
+	for _, pattern := range c.AllowedTargets {
+		target, err := regexp.Compile("^(?:" + pattern + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid allowed target pattern: %s", err)
+		}
+		h.allowedTargets = append(h.allowedTargets, target)
+	}
+	return h, nil
+}
+
+// Normalizes targets that are file paths, so that they are matched against
+// the allowed patterns in the form in which they are read.
+func cleanTarget(target string) string {
+	if strings.Contains(target, "://") {
+		return target
+	}
+	return filepath.Clean(target)
+}
+
+// Reports whether a target may be probed. Parameters of management
+// addresses are controlled by the module, so targets carrying any are
+// rejected, as are targets with .. segments, which could escape the
+// directories of the allowed patterns.
+func (h *Handler) allowed(target string) bool {
+	if strings.Contains(target, "?") || slices.Contains(strings.Split(target, "/"), "..") {
+		return false
+	}
+	target = cleanTarget(target)
+	for _, allowedTarget := range h.allowedTargets {
+		if allowedTarget.MatchString(target) {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	target := r.URL.Query().Get("target")
+	if target == "" {
+		http.Error(w, "target parameter is missing", http.StatusBadRequest)
+		return
+	}
+	moduleName := r.URL.Query().Get("module")
+	if moduleName == "" {
+		moduleName = "default"
+	}
+	module, ok := h.modules[moduleName]
+	if !ok {
+		http.Error(w, fmt.Sprintf("unknown module %q", moduleName), http.StatusBadRequest)
+		return
+	}
+	if !h.allowed(target) {
+		slog.Warn("Rejected probe of target that is not allowed", "target", target)
+		http.Error(w, fmt.Sprintf("target %q is not allowed", target), http.StatusForbidden)
+		return
+	}
+
+	statusPath := cleanTarget(target)
+	version := module.Version
+	if version == "" {
+		version = "2.3"
+	}
+	exporter, err := exporters.NewOpenVPNExporter([]string{statusPath}, module.IgnoreIndividuals, version)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	exporter.SetIgnoreRealPort(module.IgnoreRealPort)
+	if module.PasswordFile != "" {
+		// Only used for management interfaces, and kept out of the
+		// status_path label.
+		exporter.SetPasswordFile(statusPath, module.PasswordFile)
+	}
+	if module.Timezone != "" {
+		// The zone has been validated when loading the configuration.
+		location, err := time.LoadLocation(module.Timezone)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		exporter.SetLocation(statusPath, location)
+	}
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(exporter)
+
+	// The status is read while gathering, so the metrics are gathered
+	// up front to measure how long that takes.
+	start := time.Now()
+	families, err := registry.Gather()
+	if err != nil {
+		slog.Warn("Failed to gather metrics of target", "target", target, "err", err)
+	}
+	probeDurationGauge := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: prometheus.BuildFQName("openvpn", "probe", "duration_seconds"),
+		Help: "How long the probe took to complete, in seconds.",
+	})
+	probeDurationGauge.Set(time.Since(start).Seconds())
+	durationRegistry := prometheus.NewRegistry()
+	durationRegistry.MustRegister(probeDurationGauge)
+
+	gatherers := prometheus.Gatherers{
+		prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) { return families, nil }),
+		durationRegistry,
+	}
+	promhttp.HandlerFor(gatherers, promhttp.HandlerOpts{}).ServeHTTP(w, r)
+}
@@ -0,0 +1,89 @@
+package probe
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/kumina/openvpn_exporter/pkg/config"
+)
+
+func TestHandler(t *testing.T) {
+	examples, err := filepath.Abs("../../examples")
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler, err := NewHandler(config.ProbeConfig{
+		AllowedTargets: []string{regexp.QuoteMeta(examples) + `/.*\.status`, `/var/run/openvpn/.*`, `unix:///run/openvpn/.*\.sock`},
+		Modules: map[string]config.ModuleConfig{
+			"default":    {},
+			"v24":        {Version: "2.4", IgnoreIndividuals: true},
+			"management": {PasswordFile: "/etc/openvpn_exporter/management.pw"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	probe := func(target string, module string) (int, string) {
+		query := url.Values{"target": {target}}
+		if module != "" {
+			query.Set("module", module)
+		}
+		response, err := http.Get(server.URL + "/probe?" + query.Encode())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer response.Body.Close()
+		body, _ := io.ReadAll(response.Body)
+		return response.StatusCode, string(body)
+	}
+
+	statusPath := examples + "/version-2.4/server.status"
+	status, body := probe(examples+"/version-2.4/./server.status", "v24")
+	if status != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", status, body)
+	}
+	for _, expected := range []string{
+		`openvpn_up{status_path="` + statusPath + `"} 1`,
+		`openvpn_server_client_received_bytes_total{common_name="client1",status_path="` + statusPath + `"} 621910`,
+		`openvpn_probe_duration_seconds `,
+	} {
+		if !strings.Contains(body, expected) {
+			t.Errorf("expected %q in:\n%s", expected, body)
+		}
+	}
+
+	// Unreadable targets are reported as down.
+	if status, body := probe("unix:///run/openvpn/missing.sock", ""); status != http.StatusOK || !strings.Contains(body, `openvpn_up{status_path="unix:///run/openvpn/missing.sock"} 0`) {
+		t.Errorf("expected target to be down, got %d: %s", status, body)
+	}
+	// The password file of the module is left out of the label.
+	if status, body := probe("unix:///run/openvpn/missing.sock", "management"); status != http.StatusOK || !strings.Contains(body, `openvpn_up{status_path="unix:///run/openvpn/missing.sock"} 0`) {
+		t.Errorf("expected target to be down, got %d: %s", status, body)
+	}
+
+	for _, test := range []struct {
+		target string
+		module string
+		status int
+	}{
+		{"/etc/shadow", "", http.StatusForbidden},
+		{"unix:///run/openvpn/server.sock?password_file=/etc/shadow", "", http.StatusForbidden},
+		{"/var/run/openvpn/../../etc/x", "", http.StatusForbidden},
+		{examples + "/../../../etc/x.status", "", http.StatusForbidden},
+		{statusPath, "unknown", http.StatusBadRequest},
+		{"", "", http.StatusBadRequest},
+	} {
+		if status, body := probe(test.target, test.module); status != test.status {
+			t.Errorf("%q: expected status %d, got %d: %s", test.target, test.status, status, body)
+		}
+	}
+}
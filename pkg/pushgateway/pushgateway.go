@@ -0,0 +1,232 @@
+package pushgateway
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/push"
+	dto "github.com/prometheus/client_model/go"
+)
+
+type Config struct {
+	URL            string
+	Job            string
+	Interval       time.Duration
+	Retries        int
+	GroupingLabels []string
+	// Grouping key of metrics lacking all of the grouping labels, and
+	// added to every other group as well.
+	Grouping map[string]string
+	// Values of grouping labels for metrics lacking them, e.g. the host
+	// name as instance for status paths not found through discovery.
+	DefaultGrouping map[string]string
+	Client          *http.Client
+}
+
+// Periodically pushes gathered metrics to a Pushgateway. Metrics are split
+// into groups by the values of the grouping labels, e.g. one group per
+// discovered OpenVPN instance, so that a source disappearing only affects
+// its own group.
+type Pusher struct {
+	config   Config
+	gatherer prometheus.Gatherer
+	backoff  time.Duration
+
+	mu     sync.Mutex
+	pushed map[string]map[string]string
+}
+
+func NewPusher(config Config, gatherer prometheus.Gatherer) (*Pusher, error) {
+	if config.URL == "" {
+		return nil, fmt.Errorf("no Pushgateway URL configured")
+	}
+	if config.Job == "" {
+		return nil, fmt.Errorf("no job name configured")
+	}
+	for _, label := range config.GroupingLabels {
+		if _, ok := config.Grouping[label]; ok {
+			return nil, fmt.Errorf("label %s is both a grouping label and a fixed grouping key", label)
+		}
+	}
+	if config.Client == nil {
+		config.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &Pusher{
+		config:   config,
+		gatherer: gatherer,
+		backoff:  time.Second,
+		pushed:   map[string]map[string]string{},
+	}, nil
+}
+
+// Returns a string uniquely identifying a grouping key.
+func groupID(grouping map[string]string) string {
+	var parts []string
+	for name, value := range grouping {
+		parts = append(parts, name+"="+value)
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, "\xff")
+}
+
+// Splits metric families into groups by the values of the grouping
+// labels, removing those labels from the metrics. The Pushgateway rejects
+// metrics that carry labels of their grouping key.
+func (p *Pusher) partition(families []*dto.MetricFamily) (map[string]map[string]string, map[string][]*dto.MetricFamily) {
+	groupings := map[string]map[string]string{}
+	partitions := map[string][]*dto.MetricFamily{}
+	for _, family := range families {
+		partitionFamilies := map[string]*dto.MetricFamily{}
+		for _, metric := range family.Metric {
+			grouping := map[string]string{}
+			for name, value := range p.config.Grouping {
+				grouping[name] = value
+			}
+			var labels []*dto.LabelPair
+			for _, label := range metric.Label {
+				isGroupingLabel := false
+				for _, name := range p.config.GroupingLabels {
+					// Empty labels are the same as missing ones, so
+					// they are dropped as well.
+					if label.GetName() == name {
+						if label.GetValue() != "" {
+							grouping[name] = label.GetValue()
+						}
+						isGroupingLabel = true
+					}
+				}
+				if !isGroupingLabel {
+					labels = append(labels, label)
+				}
+			}
+			for name, value := range p.config.DefaultGrouping {
+				if _, ok := grouping[name]; !ok {
+					grouping[name] = value
+				}
+			}
+			id := groupID(grouping)
+			groupings[id] = grouping
+			partitionFamily, ok := partitionFamilies[id]
+			if !ok {
+				partitionFamily = &dto.MetricFamily{Name: family.Name, Help: family.Help, Type: family.Type}
+				partitionFamilies[id] = partitionFamily
+				partitions[id] = append(partitions[id], partitionFamily)
+			}
+			partitionFamily.Metric = append(partitionFamily.Metric, &dto.Metric{
+				Label:       labels,
+				Gauge:       metric.Gauge,
+				Counter:     metric.Counter,
+				Summary:     metric.Summary,
+				Untyped:     metric.Untyped,
+				Histogram:   metric.Histogram,
+				TimestampMs: metric.TimestampMs,
+			})
+		}
+	}
+	return groupings, partitions
+}
+
+func (p *Pusher) newPusher(grouping map[string]string) *push.Pusher {
+	pusher := push.New(p.config.URL, p.config.Job).Client(p.config.Client)
+	var names []string
+	for name := range grouping {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		pusher = pusher.Grouping(name, grouping[name])
+	}
+	return pusher
+}
+
+// Calls the given function until it succeeds, retrying with exponential
+// backoff up to the configured number of times.
+func (p *Pusher) retry(ctx context.Context, f func() error) error {
+	backoff := p.backoff
+	for attempt := 0; ; attempt++ {
+		err := f()
+		if err == nil || attempt >= p.config.Retries {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// Gathers all metrics and pushes every group, replacing the metrics
+// previously pushed for it.
+func (p *Pusher) Push(ctx context.Context) error {
+	families, err := p.gatherer.Gather()
+	if err != nil {
+		return fmt.Errorf("failed to gather metrics: %s", err)
+	}
+	groupings, partitions := p.partition(families)
+	var failed []string
+	for id, grouping := range groupings {
+		partition := partitions[id]
+		gatherer := prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) { return partition, nil })
+		err := p.retry(ctx, func() error {
+			return p.newPusher(grouping).Gatherer(gatherer).PushContext(ctx)
+		})
+		if err != nil {
+			failed = append(failed, fmt.Sprintf("%v: %s", grouping, err))
+			continue
+		}
+		p.mu.Lock()
+		p.pushed[id] = grouping
+		p.mu.Unlock()
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("failed to push %d of %d groups: %s", len(failed), len(groupings), strings.Join(failed, "; "))
+	}
+	return nil
+}
+
+// Deletes all groups that have been pushed from the Pushgateway.
+func (p *Pusher) Delete(ctx context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var failed []string
+	for id, grouping := range p.pushed {
+		err := p.retry(ctx, func() error {
+			return p.newPusher(grouping).Delete()
+		})
+		if err != nil {
+			failed = append(failed, fmt.Sprintf("%v: %s", grouping, err))
+			continue
+		}
+		delete(p.pushed, id)
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("failed to delete groups: %s", strings.Join(failed, "; "))
+	}
+	return nil
+}
+
+// Pushes metrics at the configured interval until the context is
+// cancelled.
+func (p *Pusher) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.config.Interval)
+	defer ticker.Stop()
+	for {
+		if err := p.Push(ctx); err != nil {
+			slog.Warn("Failed to push metrics", "url", p.config.URL, "err", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package pushgateway
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type request struct {
+	method string
+	path   string
+	body   string
+}
+
+// Records the requests made to a Pushgateway stand-in, failing the first
+// ones with a server error.
+type fakePushgateway struct {
+	mu       sync.Mutex
+	failures int
+	requests []request
+}
+
+func (f *fakePushgateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.failures > 0 {
+		f.failures--
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	body, _ := io.ReadAll(r.Body)
+	f.requests = append(f.requests, request{r.Method, r.URL.Path, string(body)})
+	if r.Method == http.MethodDelete {
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
+
+// Returns the grouping keys of the requests made with a method, as paths
+// with the labels sorted by name. The Pushgateway client orders the
+// labels of a path randomly.
+func (f *fakePushgateway) paths(method string) []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var paths []string
+	for _, r := range f.requests {
+		if r.method != method {
+			continue
+		}
+		parts := strings.Split(strings.TrimPrefix(r.path, "/metrics/"), "/")
+		var labels []string
+		for i := 2; i+1 < len(parts); i += 2 {
+			labels = append(labels, parts[i]+"/"+parts[i+1])
+		}
+		sort.Strings(labels)
+		paths = append(paths, "/metrics/"+strings.Join(append(parts[:2:2], labels...), "/"))
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+func TestPusher(t *testing.T) {
+	gateway := &fakePushgateway{failures: 1}
+	server := httptest.NewServer(gateway)
+	defer server.Close()
+
+	registry := prometheus.NewRegistry()
+	up := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "openvpn_up"}, []string{"instance", "status_path"})
+	up.WithLabelValues("tun0", "/run/tun0.status").Set(1)
+	up.WithLabelValues("tun1", "/run/tun1.status").Set(0)
+	registry.MustRegister(up)
+	registry.MustRegister(prometheus.NewGauge(prometheus.GaugeOpts{Name: "openvpn_pki_crl_revoked_certificates"}))
+
+	pusher, err := NewPusher(Config{
+		URL:            server.URL,
+		Job:            "openvpn",
+		Retries:        1,
+		GroupingLabels: []string{"instance"},
+		Grouping:       map[string]string{"site": "ams"},
+	}, registry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pusher.backoff = time.Millisecond
+	if err := pusher.Push(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// Metrics lacking the instance label are pushed with the fixed
+	// grouping key only.
+	expected := []string{
+		"/metrics/job/openvpn/instance/tun0/site/ams",
+		"/metrics/job/openvpn/instance/tun1/site/ams",
+		"/metrics/job/openvpn/site/ams",
+	}
+	if paths := gateway.paths(http.MethodPut); strings.Join(paths, " ") != strings.Join(expected, " ") {
+		t.Errorf("expected pushes to %v, got %v", expected, paths)
+	}
+	for _, r := range gateway.requests {
+		if strings.Contains(r.body, "tun") && !strings.Contains(r.body, "status_path") {
+			t.Errorf("expected remaining labels to be pushed, got %q", r.body)
+		}
+	}
+
+	if err := pusher.Delete(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if paths := gateway.paths(http.MethodDelete); strings.Join(paths, " ") != strings.Join(expected, " ") {
+		t.Errorf("expected deletes of %v, got %v", expected, paths)
+	}
+
+	// Metrics lacking a grouping label are pushed with its default value.
+	gateway = &fakePushgateway{}
+	server = httptest.NewServer(gateway)
+	defer server.Close()
+	pusher, err = NewPusher(Config{
+		URL:             server.URL,
+		Job:             "openvpn",
+		GroupingLabels:  []string{"instance"},
+		DefaultGrouping: map[string]string{"instance": "gw1"},
+	}, registry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := pusher.Push(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	expected = []string{
+		"/metrics/job/openvpn/instance/gw1",
+		"/metrics/job/openvpn/instance/tun0",
+		"/metrics/job/openvpn/instance/tun1",
+	}
+	if paths := gateway.paths(http.MethodPut); strings.Join(paths, " ") != strings.Join(expected, " ") {
+		t.Errorf("expected pushes to %v, got %v", expected, paths)
+	}
+
+	if _, err := NewPusher(Config{URL: server.URL, Job: "openvpn", GroupingLabels: []string{"site"}, Grouping: map[string]string{"site": "ams"}}, registry); err == nil {
+		t.Error("expected error for label that is both a grouping label and a fixed grouping key")
+	}
+}
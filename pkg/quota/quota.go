@@ -0,0 +1,360 @@
+package quota
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kumina/openvpn_exporter/pkg/config"
+	"github.com/kumina/openvpn_exporter/pkg/exporters"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var byteSizeRegexp = regexp.MustCompile(`(?i)^\s*([0-9]+(?:\.[0-9]+)?)\s*([KMGTP]i?)?B?\s*$`)
+
+var byteSizeUnits = map[string]float64{
+	"":   1,
+	"K":  1e3,
+	"M":  1e6,
+	"G":  1e9,
+	"T":  1e12,
+	"P":  1e15,
+	"Ki": 1 << 10,
+	"Mi": 1 << 20,
+	"Gi": 1 << 30,
+	"Ti": 1 << 40,
+	"Pi": 1 << 50,
+}
+
+// Parses a number of bytes, optionally followed by a decimal (KB, MB,
+// ...) or binary (KiB, MiB, ...) unit.
+func parseByteSize(value string) (float64, error) {
+	match := byteSizeRegexp.FindStringSubmatch(value)
+	if match == nil {
+		return 0, fmt.Errorf("invalid size %q", value)
+	}
+	number, err := strconv.ParseFloat(match[1], 64)
+	if err != nil {
+		return 0, err
+	}
+	unit := strings.ToUpper(match[2])
+	if len(unit) == 2 {
+		unit = unit[:1] + "i"
+	}
+	return number * byteSizeUnits[unit], nil
+}
+
+// Recurring period over which traffic is accounted.
+type schedule struct {
+	period   string
+	resetDay int
+}
+
+func newSchedule(period string, resetDay int) (schedule, error) {
+	switch period {
+	case "":
+		period = "monthly"
+		fallthrough
+	case "monthly":
+		if resetDay == 0 {
+			resetDay = 1
+		}
+		if resetDay < 1 || resetDay > 28 {
+			return schedule{}, fmt.Errorf("reset_day of monthly periods must be between 1 and 28")
+		}
+	case "weekly":
+		if resetDay < 0 || resetDay > 6 {
+			return schedule{}, fmt.Errorf("reset_day of weekly periods must be between 0 (Sunday) and 6")
+		}
+	case "daily":
+	default:
+		return schedule{}, fmt.Errorf("unknown period %q", period)
+	}
+	return schedule{period: period, resetDay: resetDay}, nil
+}
+
+// Returns the start of the period containing the given time, in the time
+// zone of that time.
+func (s schedule) start(t time.Time) time.Time {
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	switch s.period {
+	case "weekly":
+		return midnight.AddDate(0, 0, -((int(t.Weekday()) - s.resetDay + 7) % 7))
+	case "monthly":
+		start := time.Date(t.Year(), t.Month(), s.resetDay, 0, 0, 0, 0, t.Location())
+		if start.After(t) {
+			start = start.AddDate(0, -1, 0)
+		}
+		return start
+	}
+	return midnight
+}
+
+// Returns the start of the period following the one starting at the
+// given time.
+func (s schedule) next(start time.Time) time.Time {
+	switch s.period {
+	case "weekly":
+		return start.AddDate(0, 0, 7)
+	case "monthly":
+		return start.AddDate(0, 1, 0)
+	}
+	return start.AddDate(0, 0, 1)
+}
+
+type limit struct {
+	commonName string
+	username   string
+	bytes      float64
+	schedule   schedule
+}
+
+// Returns the key under which the usage of a quota is stored, quoting the
+// name like stateSessionKey does.
+func (l limit) key() string {
+	if l.commonName != "" {
+		return "common_name:" + strconv.Quote(l.commonName)
+	}
+	return "username:" + strconv.Quote(l.username)
+}
+
+func (l limit) matches(client exporters.Client) bool {
+	if l.commonName != "" {
+		return client.CommonName == l.commonName
+	}
+	return client.Username == l.username
+}
+
+// Traffic used by a quota in its current period.
+type usage struct {
+	PeriodStart time.Time `json:"period_start"`
+	Bytes       float64   `json:"bytes"`
+}
+
+// Persistent state of the accounting, written to the state file after
+// every poll.
+type state struct {
+	Usage map[string]*usage `json:"usage"`
+	// Traffic of the sessions seen in the last poll, by status path and
+	// session key, so that traffic counted before a restart is not
+	// counted again.
+	Sessions map[string]map[string]float64 `json:"sessions"`
+}
+
+// Accounts the traffic of users against their quotas. The traffic of a
+// session is the sum of the bytes received and sent, and only the
+// increase of its counters between polls is added to the current period,
+// so traffic of sessions spanning the start of a period is split between
+// periods.
+type Tracker struct {
+	limits       []limit
+	sources      []exporters.StatusSource
+	statePath    string
+	pollInterval time.Duration
+
+	mu    sync.Mutex
+	state state
+
+	quotaUsedDesc      *prometheus.Desc
+	quotaLimitDesc     *prometheus.Desc
+	quotaExceededDesc  *prometheus.Desc
+	quotaResetTimeDesc *prometheus.Desc
+}
+
+func NewTracker(c config.QuotasConfig, sources []exporters.StatusSource, pollInterval time.Duration) (*Tracker, error) {
+	var limits []limit
+	for _, quota := range c.Limits {
+		bytes, err := parseByteSize(quota.Limit)
+		if err != nil {
+			return nil, fmt.Errorf("quota of %s%s: %s", quota.CommonName, quota.Username, err)
+		}
+		schedule, err := newSchedule(quota.Period, quota.ResetDay)
+		if err != nil {
+			return nil, fmt.Errorf("quota of %s%s: %s", quota.CommonName, quota.Username, err)
+		}
+		limits = append(limits, limit{
+			commonName: quota.CommonName,
+			username:   quota.Username,
+			bytes:      bytes,
+			schedule:   schedule,
+		})
+	}
+
+	t := &Tracker{
+		limits:       limits,
+		sources:      sources,
+		statePath:    c.StatePath,
+		pollInterval: pollInterval,
+		state: state{
+			Usage:    map[string]*usage{},
+			Sessions: map[string]map[string]float64{},
+		},
+		quotaUsedDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("openvpn", "server", "quota_used_bytes"),
+			"Traffic used in the current quota period, in bytes.",
+			[]string{"common_name", "username"}, nil),
+		quotaLimitDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("openvpn", "server", "quota_limit_bytes"),
+			"Traffic allowed per quota period, in bytes.",
+			[]string{"common_name", "username"}, nil),
+		quotaExceededDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("openvpn", "server", "quota_exceeded"),
+			"Whether the traffic used in the current quota period exceeds the limit.",
+			[]string{"common_name", "username"}, nil),
+		quotaResetTimeDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("openvpn", "server", "quota_reset_time_seconds"),
+			"UNIX timestamp at which the current quota period ends.",
+			[]string{"common_name", "username"}, nil),
+	}
+
+	content, err := os.ReadFile(c.StatePath)
+	if err == nil {
+		if err := json.Unmarshal(content, &t.state); err != nil {
+			return nil, fmt.Errorf("failed to parse quota state %s: %s", c.StatePath, err)
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read quota state: %s", err)
+	}
+	if t.state.Usage == nil {
+		t.state.Usage = map[string]*usage{}
+	}
+	if t.state.Sessions == nil {
+		t.state.Sessions = map[string]map[string]float64{}
+	}
+	return t, nil
+}
+
+// Returns the usage of a quota, starting a new period if the stored one
+// has ended.
+func (t *Tracker) usage(l limit, now time.Time) *usage {
+	start := l.schedule.start(now)
+	u, ok := t.state.Usage[l.key()]
+	if !ok || !u.PeriodStart.Equal(start) {
+		u = &usage{PeriodStart: start}
+		t.state.Usage[l.key()] = u
+	}
+	return u
+}
+
+// Returns a string identifying the session of a client in the state file.
+// Unlike Client.SessionKey, it is valid UTF-8, which JSON object keys must
+// be to survive a restart, as the common name, which may contain invalid
+// UTF-8, is quoted. Neither the connection time nor the address contain
+// slashes, so keys are unambiguous whatever the common name.
+func stateSessionKey(client exporters.Client) string {
+	return strconv.FormatInt(client.ConnectedSince.Unix(), 10) + "/" + client.RealAddress + "/" + strconv.Quote(client.CommonName)
+}
+
+// Adds the traffic of the clients of a server since the previous poll.
+// The first poll of a server without saved sessions only records their
+// counters, as the traffic of sessions connected before it cannot be
+// split between periods.
+func (t *Tracker) record(statusPath string, clients []exporters.Client, now time.Time) {
+	previous, seen := t.state.Sessions[statusPath]
+	current := map[string]float64{}
+	for _, client := range clients {
+		bytes := client.BytesReceived + client.BytesSent
+		delta := bytes
+		key := stateSessionKey(client)
+		if last, ok := previous[key]; ok && bytes >= last {
+			delta = bytes - last
+		}
+		current[key] = bytes
+		if !seen {
+			continue
+		}
+		for _, l := range t.limits {
+			if l.matches(client) {
+				t.usage(l, now).Bytes += delta
+			}
+		}
+	}
+	t.state.Sessions[statusPath] = current
+}
+
+// Writes the state to a temporary file first, so that it is never left
+// partially written.
+func (t *Tracker) save() error {
+	content, err := json.Marshal(t.state)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(t.statePath), filepath.Base(t.statePath))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), t.statePath)
+}
+
+// Reads the client list of every source and accounts their traffic.
+// Sources that cannot be read are skipped, keeping their sessions, so
+// that their traffic is accounted once they can be read again.
+func (t *Tracker) poll(now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, source := range t.sources {
+		clients, err := exporters.ReadClientList(source)
+		if err != nil {
+			slog.Warn("Failed to read client list for quotas", "status_path", source.StatusPath, "err", err)
+			continue
+		}
+		t.record(source.StatusPath, clients, now)
+	}
+	if err := t.save(); err != nil {
+		slog.Error("Failed to save quota state", "path", t.statePath, "err", err)
+	}
+}
+
+func (t *Tracker) Describe(ch chan<- *prometheus.Desc) {
+	ch <- t.quotaUsedDesc
+	ch <- t.quotaLimitDesc
+	ch <- t.quotaExceededDesc
+	ch <- t.quotaResetTimeDesc
+}
+
+func (t *Tracker) Collect(ch chan<- prometheus.Metric) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := time.Now()
+	for _, l := range t.limits {
+		u := t.usage(l, now)
+		exceeded := 0.0
+		if u.Bytes > l.bytes {
+			exceeded = 1
+		}
+		ch <- prometheus.MustNewConstMetric(t.quotaUsedDesc, prometheus.GaugeValue, u.Bytes, l.commonName, l.username)
+		ch <- prometheus.MustNewConstMetric(t.quotaLimitDesc, prometheus.GaugeValue, l.bytes, l.commonName, l.username)
+		ch <- prometheus.MustNewConstMetric(t.quotaExceededDesc, prometheus.GaugeValue, exceeded, l.commonName, l.username)
+		ch <- prometheus.MustNewConstMetric(t.quotaResetTimeDesc, prometheus.GaugeValue, float64(l.schedule.next(u.PeriodStart).Unix()), l.commonName, l.username)
+	}
+}
+
+// Accounts traffic until the context is cancelled.
+func (t *Tracker) Run(ctx context.Context) {
+	ticker := time.NewTicker(t.pollInterval)
+	defer ticker.Stop()
+	for {
+		t.poll(time.Now())
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package quota
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kumina/openvpn_exporter/pkg/config"
+	"github.com/kumina/openvpn_exporter/pkg/exporters"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestParseByteSize(t *testing.T) {
+	for value, expected := range map[string]float64{
+		"1000":    1000,
+		"50GB":    50e9,
+		"50 GiB":  50 << 30,
+		"1.5TB":   1.5e12,
+		"100 mib": 100 << 20,
+		"10k":     10e3,
+	} {
+		size, err := parseByteSize(value)
+		if err != nil {
+			t.Errorf("%q: %s", value, err)
+		} else if size != expected {
+			t.Errorf("%q: expected %g, got %g", value, expected, size)
+		}
+	}
+	if _, err := parseByteSize("lots"); err == nil {
+		t.Error("expected an error")
+	}
+}
+
+func TestScheduleStart(t *testing.T) {
+	now := time.Date(2024, 9, 18, 10, 46, 33, 0, time.UTC) // A Wednesday.
+	for _, test := range []struct {
+		period   string
+		resetDay int
+		expected time.Time
+	}{
+		{"daily", 0, time.Date(2024, 9, 18, 0, 0, 0, 0, time.UTC)},
+		{"weekly", 1, time.Date(2024, 9, 16, 0, 0, 0, 0, time.UTC)},
+		{"weekly", 4, time.Date(2024, 9, 12, 0, 0, 0, 0, time.UTC)},
+		{"monthly", 0, time.Date(2024, 9, 1, 0, 0, 0, 0, time.UTC)},
+		{"monthly", 20, time.Date(2024, 8, 20, 0, 0, 0, 0, time.UTC)},
+	} {
+		s, err := newSchedule(test.period, test.resetDay)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if start := s.start(now); !start.Equal(test.expected) {
+			t.Errorf("%s/%d: expected %s, got %s", test.period, test.resetDay, test.expected, start)
+		}
+	}
+}
+
+func TestTrackerRecord(t *testing.T) {
+	c := config.QuotasConfig{
+		StatePath: filepath.Join(t.TempDir(), "quotas.json"),
+		Limits: []config.QuotaConfig{
+			{CommonName: "alice", Limit: "1KB", Period: "daily"},
+			{Username: "bob", Limit: "1MB"},
+		},
+	}
+	tracker, err := NewTracker(c, nil, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	// Sessions connected before the first poll are not counted.
+	alice := exporters.Client{CommonName: "alice", BytesReceived: 5000, BytesSent: 5000, ConnectedSince: now.Add(-2 * time.Hour)}
+	tracker.record("/run/server.status", []exporters.Client{alice}, now)
+	alice = exporters.Client{CommonName: "alice", BytesReceived: 300, BytesSent: 300, ConnectedSince: now.Add(-time.Hour)}
+	tracker.record("/run/server.status", []exporters.Client{alice}, now)
+	if err := tracker.save(); err != nil {
+		t.Fatal(err)
+	}
+
+	// After a restart, only the increase of the counters is added.
+	tracker, err = NewTracker(c, nil, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	alice.BytesReceived = 500
+	tracker.record("/run/server.status", []exporters.Client{alice}, now)
+	// A new session counts in full.
+	alice.ConnectedSince = now
+	alice.BytesReceived, alice.BytesSent = 100, 100
+	tracker.record("/run/server.status", []exporters.Client{alice}, now)
+
+	expected := `
+# HELP openvpn_server_quota_exceeded Whether the traffic used in the current quota period exceeds the limit.
+# TYPE openvpn_server_quota_exceeded gauge
+openvpn_server_quota_exceeded{common_name="alice",username=""} 1
+openvpn_server_quota_exceeded{common_name="",username="bob"} 0
+# HELP openvpn_server_quota_limit_bytes Traffic allowed per quota period, in bytes.
+# TYPE openvpn_server_quota_limit_bytes gauge
+openvpn_server_quota_limit_bytes{common_name="alice",username=""} 1000
+openvpn_server_quota_limit_bytes{common_name="",username="bob"} 1e+06
+# HELP openvpn_server_quota_used_bytes Traffic used in the current quota period, in bytes.
+# TYPE openvpn_server_quota_used_bytes gauge
+openvpn_server_quota_used_bytes{common_name="alice",username=""} 1000
+openvpn_server_quota_used_bytes{common_name="",username="bob"} 0
+`
+	// Used bytes equal to the limit do not exceed it.
+	if err := testutil.CollectAndCompare(tracker, strings.NewReader(expected), "openvpn_server_quota_used_bytes", "openvpn_server_quota_limit_bytes"); err != nil {
+		t.Error(err)
+	}
+	alice.BytesReceived++
+	tracker.record("/run/server.status", []exporters.Client{alice}, now)
+	if err := testutil.CollectAndCompare(tracker, strings.NewReader(expected), "openvpn_server_quota_exceeded"); err != nil {
+		t.Error(err)
+	}
+}
+
+// Sessions of common names that are not valid UTF-8 are recognized after
+// a restart, rather than counted again.
+func TestTrackerInvalidUTF8(t *testing.T) {
+	c := config.QuotasConfig{
+		StatePath: filepath.Join(t.TempDir(), "quotas.json"),
+		Limits:    []config.QuotaConfig{{CommonName: "M\xfcller", Limit: "1KB"}},
+	}
+	tracker, err := NewTracker(c, nil, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	tracker.record("/run/server.status", nil, now)
+	client := exporters.Client{CommonName: "M\xfcller", BytesReceived: 100, BytesSent: 100, ConnectedSince: now}
+	tracker.record("/run/server.status", []exporters.Client{client}, now)
+	if err := tracker.save(); err != nil {
+		t.Fatal(err)
+	}
+
+	tracker, err = NewTracker(c, nil, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.BytesSent = 150
+	tracker.record("/run/server.status", []exporters.Client{client}, now)
+	if used := tracker.usage(tracker.limits[0], now).Bytes; used != 250 {
+		t.Errorf("expected 250 bytes used, got %v", used)
+	}
+}
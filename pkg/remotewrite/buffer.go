@@ -0,0 +1,208 @@
+package remotewrite
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// First-in, first-out queue of compressed write requests waiting to be
+// sent. Requests are sent in order, as receivers reject samples older
+// than ones they already have for a series. Every request has a sequence
+// number, so that a request that was sent is only removed if it has not
+// been dropped in the meantime to make room for newer ones.
+type buffer interface {
+	push(request []byte) error
+	// Returns the oldest request and its sequence number, or nil if the
+	// buffer is empty.
+	peek() (uint64, []byte, error)
+	// Removes the request with the given sequence number, if it is still
+	// buffered.
+	pop(sequence uint64) error
+	len() int
+}
+
+// Buffer held in memory, dropping the oldest requests once it holds the
+// maximum number of them.
+type memoryBuffer struct {
+	mu          sync.Mutex
+	requests    []bufferedRequest
+	maxRequests int
+	dropped     func(int)
+	next        uint64
+}
+
+type bufferedRequest struct {
+	sequence uint64
+	request  []byte
+}
+
+func newMemoryBuffer(maxRequests int, dropped func(int)) *memoryBuffer {
+	return &memoryBuffer{maxRequests: maxRequests, dropped: dropped}
+}
+
+func (b *memoryBuffer) push(request []byte) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.requests = append(b.requests, bufferedRequest{b.next, request})
+	b.next++
+	if excess := len(b.requests) - b.maxRequests; excess > 0 {
+		b.requests = b.requests[excess:]
+		b.dropped(excess)
+	}
+	return nil
+}
+
+func (b *memoryBuffer) peek() (uint64, []byte, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.requests) == 0 {
+		return 0, nil, nil
+	}
+	return b.requests[0].sequence, b.requests[0].request, nil
+}
+
+func (b *memoryBuffer) pop(sequence uint64) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.requests) > 0 && b.requests[0].sequence == sequence {
+		b.requests = b.requests[1:]
+	}
+	return nil
+}
+
+func (b *memoryBuffer) len() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.requests)
+}
+
+// Buffer stored as one file per request in a directory, so that requests
+// survive both outages of the receiver and restarts of the exporter. Once
+// the files exceed the maximum size, the oldest ones are removed.
+type diskBuffer struct {
+	mu       sync.Mutex
+	dir      string
+	maxBytes int64
+	dropped  func(int)
+	// Sequence numbers and sizes of the stored requests, oldest first.
+	sequences []uint64
+	sizes     map[uint64]int64
+	total     int64
+	next      uint64
+}
+
+const diskBufferSuffix = ".snappy"
+
+func newDiskBuffer(dir string, maxBytes int64, dropped func(int)) (*diskBuffer, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	b := &diskBuffer{dir: dir, maxBytes: maxBytes, dropped: dropped, sizes: map[uint64]int64{}}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasSuffix(name, diskBufferSuffix) {
+			if strings.HasSuffix(name, ".tmp") {
+				// Left behind by an interrupted write.
+				os.Remove(filepath.Join(dir, name))
+			}
+			continue
+		}
+		sequence, err := strconv.ParseUint(strings.TrimSuffix(name, diskBufferSuffix), 10, 64)
+		if err != nil {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+		b.sequences = append(b.sequences, sequence)
+		b.sizes[sequence] = info.Size()
+		b.total += info.Size()
+		if sequence >= b.next {
+			b.next = sequence + 1
+		}
+	}
+	sort.Slice(b.sequences, func(i, j int) bool { return b.sequences[i] < b.sequences[j] })
+	return b, nil
+}
+
+func (b *diskBuffer) path(sequence uint64) string {
+	return filepath.Join(b.dir, fmt.Sprintf("%020d%s", sequence, diskBufferSuffix))
+}
+
+func (b *diskBuffer) push(request []byte) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	sequence := b.next
+	tmpPath := b.path(sequence) + ".tmp"
+	if err := os.WriteFile(tmpPath, request, 0o600); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := os.Rename(tmpPath, b.path(sequence)); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	b.next++
+	b.sequences = append(b.sequences, sequence)
+	b.sizes[sequence] = int64(len(request))
+	b.total += int64(len(request))
+
+	dropped := 0
+	for b.total > b.maxBytes && len(b.sequences) > 1 {
+		if err := b.removeOldest(); err != nil {
+			return err
+		}
+		dropped++
+	}
+	if dropped > 0 {
+		b.dropped(dropped)
+	}
+	return nil
+}
+
+func (b *diskBuffer) removeOldest() error {
+	sequence := b.sequences[0]
+	if err := os.Remove(b.path(sequence)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	b.sequences = b.sequences[1:]
+	b.total -= b.sizes[sequence]
+	delete(b.sizes, sequence)
+	return nil
+}
+
+func (b *diskBuffer) peek() (uint64, []byte, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.sequences) == 0 {
+		return 0, nil, nil
+	}
+	sequence := b.sequences[0]
+	request, err := os.ReadFile(b.path(sequence))
+	return sequence, request, err
+}
+
+func (b *diskBuffer) pop(sequence uint64) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.sequences) == 0 || b.sequences[0] != sequence {
+		return nil
+	}
+	return b.removeOldest()
+}
+
+func (b *diskBuffer) len() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.sequences)
+}
@@ -0,0 +1,149 @@
+package remotewrite
+
+import (
+	"math"
+	"sort"
+	"strconv"
+
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+type label struct {
+	name  string
+	value string
+}
+
+type sample struct {
+	value     float64
+	timestamp int64
+}
+
+type timeSeries struct {
+	labels  []label
+	samples []sample
+}
+
+// Builds a series for a single sample, sorting its labels by name as
+// required by the remote write protocol.
+func newTimeSeries(name string, labels []label, value float64, timestamp int64) timeSeries {
+	seriesLabels := make([]label, 0, len(labels)+1)
+	seriesLabels = append(seriesLabels, label{"__name__", name})
+	seriesLabels = append(seriesLabels, labels...)
+	sort.Slice(seriesLabels, func(i, j int) bool { return seriesLabels[i].name < seriesLabels[j].name })
+	return timeSeries{labels: seriesLabels, samples: []sample{{value, timestamp}}}
+}
+
+// Converts gathered metric families into series, expanding summaries and
+// histograms the same way the text exposition format does. Metrics
+// without a timestamp get the given one.
+func toTimeSeries(families []*dto.MetricFamily, externalLabels map[string]string, timestamp int64) []timeSeries {
+	var series []timeSeries
+	for _, family := range families {
+		name := family.GetName()
+		for _, metric := range family.Metric {
+			ts := timestamp
+			if metric.TimestampMs != nil {
+				ts = metric.GetTimestampMs()
+			}
+			// Empty labels are the same as missing ones, which receivers
+			// expect to be left out, like Prometheus does when scraping.
+			var labels []label
+			for labelName, value := range externalLabels {
+				if value != "" {
+					labels = append(labels, label{labelName, value})
+				}
+			}
+			for _, pair := range metric.Label {
+				if pair.GetValue() == "" {
+					continue
+				}
+				if _, ok := externalLabels[pair.GetName()]; ok {
+					// Labels of the metric take precedence.
+					labels = removeLabel(labels, pair.GetName())
+				}
+				labels = append(labels, label{pair.GetName(), pair.GetValue()})
+			}
+
+			switch family.GetType() {
+			case dto.MetricType_COUNTER:
+				series = append(series, newTimeSeries(name, labels, metric.GetCounter().GetValue(), ts))
+			case dto.MetricType_GAUGE:
+				series = append(series, newTimeSeries(name, labels, metric.GetGauge().GetValue(), ts))
+			case dto.MetricType_UNTYPED:
+				series = append(series, newTimeSeries(name, labels, metric.GetUntyped().GetValue(), ts))
+			case dto.MetricType_SUMMARY:
+				summary := metric.GetSummary()
+				for _, quantile := range summary.Quantile {
+					quantileLabels := append(labels[:len(labels):len(labels)], label{"quantile", formatFloat(quantile.GetQuantile())})
+					series = append(series, newTimeSeries(name, quantileLabels, quantile.GetValue(), ts))
+				}
+				series = append(series, newTimeSeries(name+"_sum", labels, summary.GetSampleSum(), ts))
+				series = append(series, newTimeSeries(name+"_count", labels, float64(summary.GetSampleCount()), ts))
+			case dto.MetricType_HISTOGRAM:
+				histogram := metric.GetHistogram()
+				hasInf := false
+				for _, bucket := range histogram.Bucket {
+					if math.IsInf(bucket.GetUpperBound(), 1) {
+						hasInf = true
+					}
+					bucketLabels := append(labels[:len(labels):len(labels)], label{"le", formatFloat(bucket.GetUpperBound())})
+					series = append(series, newTimeSeries(name+"_bucket", bucketLabels, float64(bucket.GetCumulativeCount()), ts))
+				}
+				if !hasInf {
+					infLabels := append(labels[:len(labels):len(labels)], label{"le", "+Inf"})
+					series = append(series, newTimeSeries(name+"_bucket", infLabels, float64(histogram.GetSampleCount()), ts))
+				}
+				series = append(series, newTimeSeries(name+"_sum", labels, histogram.GetSampleSum(), ts))
+				series = append(series, newTimeSeries(name+"_count", labels, float64(histogram.GetSampleCount()), ts))
+			}
+		}
+	}
+	return series
+}
+
+func removeLabel(labels []label, name string) []label {
+	for i, l := range labels {
+		if l.name == name {
+			return append(labels[:i], labels[i+1:]...)
+		}
+	}
+	return labels
+}
+
+func formatFloat(value float64) string {
+	if math.IsInf(value, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+// Encodes series as a prometheus.WriteRequest protocol buffer message.
+func marshalWriteRequest(series []timeSeries) []byte {
+	var request []byte
+	var message []byte
+	for _, s := range series {
+		message = message[:0]
+		for _, l := range s.labels {
+			var labelMessage []byte
+			labelMessage = protowire.AppendTag(labelMessage, 1, protowire.BytesType)
+			labelMessage = protowire.AppendString(labelMessage, l.name)
+			labelMessage = protowire.AppendTag(labelMessage, 2, protowire.BytesType)
+			labelMessage = protowire.AppendString(labelMessage, l.value)
+			message = protowire.AppendTag(message, 1, protowire.BytesType)
+			message = protowire.AppendBytes(message, labelMessage)
+		}
+		for _, sm := range s.samples {
+			var sampleMessage []byte
+			sampleMessage = protowire.AppendTag(sampleMessage, 1, protowire.Fixed64Type)
+			sampleMessage = protowire.AppendFixed64(sampleMessage, math.Float64bits(sm.value))
+			sampleMessage = protowire.AppendTag(sampleMessage, 2, protowire.VarintType)
+			sampleMessage = protowire.AppendVarint(sampleMessage, uint64(sm.timestamp))
+			message = protowire.AppendTag(message, 2, protowire.BytesType)
+			message = protowire.AppendBytes(message, sampleMessage)
+		}
+		request = protowire.AppendTag(request, 1, protowire.BytesType)
+		request = protowire.AppendBytes(request, message)
+	}
+	return request
+}
@@ -0,0 +1,207 @@
+package remotewrite
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type Config struct {
+	URL      string
+	Interval time.Duration
+	// Labels added to every series, as remote write has no equivalent of
+	// the target labels Prometheus adds when scraping.
+	ExternalLabels  map[string]string
+	Headers         map[string]string
+	BearerTokenFile string
+	// Directory in which requests are buffered while the receiver is
+	// unavailable. If empty, they are buffered in memory.
+	BufferDir      string
+	BufferMaxBytes int64
+	QueueSize      int
+	MinBackoff     time.Duration
+	MaxBackoff     time.Duration
+	Timeout        time.Duration
+}
+
+// Sends the gathered metrics to a Prometheus remote write endpoint at a
+// fixed interval. Every collection becomes one snappy compressed
+// WriteRequest, which is queued and retried with backoff until the
+// receiver accepts it or it is dropped to keep the buffer bounded.
+type Client struct {
+	config   Config
+	gatherer prometheus.Gatherer
+	buffer   buffer
+	client   *http.Client
+	queued   chan struct{}
+}
+
+// Error returned for requests that will never succeed, such as those
+// rejected with a 400 Bad Request.
+type unrecoverableError struct {
+	err error
+}
+
+func (e unrecoverableError) Error() string {
+	return e.err.Error()
+}
+
+func NewClient(config Config, gatherer prometheus.Gatherer) (*Client, error) {
+	if config.URL == "" {
+		return nil, fmt.Errorf("no remote write URL configured")
+	}
+	dropped := func(count int) {
+		slog.Warn("Remote write buffer is full, dropped oldest requests", "url", config.URL, "dropped", count)
+	}
+	var b buffer
+	if config.BufferDir != "" {
+		diskBuffer, err := newDiskBuffer(config.BufferDir, config.BufferMaxBytes, dropped)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open remote write buffer: %s", err)
+		}
+		b = diskBuffer
+	} else {
+		b = newMemoryBuffer(config.QueueSize, dropped)
+	}
+	return &Client{
+		config:   config,
+		gatherer: gatherer,
+		buffer:   b,
+		client:   &http.Client{Timeout: config.Timeout},
+		queued:   make(chan struct{}, 1),
+	}, nil
+}
+
+// Gathers all metrics and queues them as a single write request.
+func (c *Client) Collect() error {
+	families, err := c.gatherer.Gather()
+	if err != nil {
+		return fmt.Errorf("failed to gather metrics: %s", err)
+	}
+	series := toTimeSeries(families, c.config.ExternalLabels, time.Now().UnixMilli())
+	if len(series) == 0 {
+		return nil
+	}
+	request := snappy.Encode(nil, marshalWriteRequest(series))
+	if err := c.buffer.push(request); err != nil {
+		return fmt.Errorf("failed to queue write request: %s", err)
+	}
+	select {
+	case c.queued <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+func (c *Client) send(ctx context.Context, request []byte) error {
+	httpRequest, err := http.NewRequestWithContext(ctx, http.MethodPost, c.config.URL, bytes.NewReader(request))
+	if err != nil {
+		return unrecoverableError{err}
+	}
+	httpRequest.Header.Set("Content-Encoding", "snappy")
+	httpRequest.Header.Set("Content-Type", "application/x-protobuf")
+	httpRequest.Header.Set("User-Agent", "openvpn_exporter")
+	httpRequest.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	for name, value := range c.config.Headers {
+		httpRequest.Header.Set(name, value)
+	}
+	if c.config.BearerTokenFile != "" {
+		token, err := os.ReadFile(c.config.BearerTokenFile)
+		if err != nil {
+			return fmt.Errorf("failed to read bearer token: %s", err)
+		}
+		httpRequest.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	}
+
+	response, err := c.client.Do(httpRequest)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode/100 == 2 {
+		_, _ = io.Copy(io.Discard, response.Body)
+		return nil
+	}
+	body, _ := io.ReadAll(io.LimitReader(response.Body, 512))
+	err = fmt.Errorf("server returned %s: %s", response.Status, bytes.TrimSpace(body))
+	if response.StatusCode/100 == 4 && response.StatusCode != http.StatusTooManyRequests {
+		return unrecoverableError{err}
+	}
+	return err
+}
+
+// Sends queued requests, oldest first, until the buffer is empty.
+func (c *Client) flush(ctx context.Context) {
+	backoff := c.config.MinBackoff
+	for ctx.Err() == nil {
+		sequence, request, err := c.buffer.peek()
+		if err != nil {
+			slog.Error("Failed to read remote write buffer, dropping request", "err", err)
+			c.buffer.pop(sequence)
+			continue
+		}
+		if request == nil {
+			return
+		}
+		err = c.send(ctx, request)
+		if err == nil || errors.As(err, &unrecoverableError{}) {
+			if err != nil {
+				slog.Warn("Remote write request rejected, dropping it", "url", c.config.URL, "err", err)
+			}
+			if err := c.buffer.pop(sequence); err != nil {
+				slog.Error("Failed to remove request from remote write buffer", "err", err)
+			}
+			backoff = c.config.MinBackoff
+			continue
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		slog.Warn("Remote write failed, retrying", "url", c.config.URL, "backoff", backoff, "queued", c.buffer.len(), "err", err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, c.config.MaxBackoff)
+	}
+}
+
+// Collects and sends metrics until the context is cancelled. Requests
+// that could not be sent by then remain in the disk buffer, if one is
+// configured, and are sent after the next start.
+func (c *Client) Run(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(c.config.Interval)
+		defer ticker.Stop()
+		for {
+			if err := c.Collect(); err != nil {
+				slog.Warn("Remote write collection failed", "err", err)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	for {
+		c.flush(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-c.queued:
+		}
+	}
+}
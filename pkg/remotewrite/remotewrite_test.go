@@ -0,0 +1,261 @@
+package remotewrite
+
+import (
+	"context"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Decodes a WriteRequest into series, checking the wire format on the
+// way.
+func unmarshalWriteRequest(t *testing.T, data []byte) []timeSeries {
+	fields := func(data []byte, handle func(protowire.Number, protowire.Type, []byte)) {
+		for len(data) > 0 {
+			number, typ, n := protowire.ConsumeTag(data)
+			if n < 0 {
+				t.Fatal(protowire.ParseError(n))
+			}
+			data = data[n:]
+			n = protowire.ConsumeFieldValue(number, typ, data)
+			if n < 0 {
+				t.Fatal(protowire.ParseError(n))
+			}
+			handle(number, typ, data[:n])
+			data = data[n:]
+		}
+	}
+	var series []timeSeries
+	fields(data, func(_ protowire.Number, _ protowire.Type, value []byte) {
+		message, _ := protowire.ConsumeBytes(value)
+		var s timeSeries
+		fields(message, func(number protowire.Number, _ protowire.Type, value []byte) {
+			inner, _ := protowire.ConsumeBytes(value)
+			if number == 1 {
+				var l label
+				fields(inner, func(number protowire.Number, _ protowire.Type, value []byte) {
+					text, _ := protowire.ConsumeString(value)
+					if number == 1 {
+						l.name = text
+					} else {
+						l.value = text
+					}
+				})
+				s.labels = append(s.labels, l)
+			} else {
+				var sm sample
+				fields(inner, func(number protowire.Number, _ protowire.Type, value []byte) {
+					if number == 1 {
+						bits, _ := protowire.ConsumeFixed64(value)
+						sm.value = math.Float64frombits(bits)
+					} else {
+						timestamp, _ := protowire.ConsumeVarint(value)
+						sm.timestamp = int64(timestamp)
+					}
+				})
+				s.samples = append(s.samples, sm)
+			}
+		})
+		series = append(series, s)
+	})
+	return series
+}
+
+func TestClientSendsWriteRequests(t *testing.T) {
+	var mu sync.Mutex
+	failures := 2
+	var received []timeSeries
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if failures > 0 {
+			failures--
+			http.Error(w, "overloaded", http.StatusServiceUnavailable)
+			return
+		}
+		if r.Header.Get("Content-Encoding") != "snappy" || r.Header.Get("X-Scope-OrgID") != "vpn" {
+			http.Error(w, "unexpected headers", http.StatusBadRequest)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		data, err := snappy.Decode(nil, body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		received = append(received, unmarshalWriteRequest(t, data)...)
+	}))
+	defer server.Close()
+
+	registry := prometheus.NewRegistry()
+	up := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "openvpn_up", Help: "Up."}, []string{"status_path"})
+	up.WithLabelValues("/run/server.status").Set(1)
+	registry.MustRegister(up)
+
+	client, err := NewClient(Config{
+		URL:            server.URL,
+		ExternalLabels: map[string]string{"job": "openvpn", "instance": "gw1"},
+		Headers:        map[string]string{"X-Scope-OrgID": "vpn"},
+		BufferDir:      t.TempDir(),
+		BufferMaxBytes: 1 << 20,
+		MinBackoff:     time.Millisecond,
+		MaxBackoff:     time.Millisecond,
+		Timeout:        time.Second,
+	}, registry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Collect(); err != nil {
+		t.Fatal(err)
+	}
+	client.flush(context.Background())
+
+	if client.buffer.len() != 0 {
+		t.Errorf("expected buffer to be empty, got %d requests", client.buffer.len())
+	}
+	if len(received) != 1 {
+		t.Fatalf("expected 1 series, got %d", len(received))
+	}
+	expected := []label{
+		{"__name__", "openvpn_up"},
+		{"instance", "gw1"},
+		{"job", "openvpn"},
+		{"status_path", "/run/server.status"},
+	}
+	if !reflect.DeepEqual(received[0].labels, expected) {
+		t.Errorf("expected labels %v, got %v", expected, received[0].labels)
+	}
+	if len(received[0].samples) != 1 || received[0].samples[0].value != 1 {
+		t.Errorf("unexpected samples %v", received[0].samples)
+	}
+}
+
+func TestDiskBuffer(t *testing.T) {
+	dir := t.TempDir()
+	dropped := 0
+	b, err := newDiskBuffer(dir, 11, func(count int) { dropped += count })
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, request := range []string{"first", "second", "third"} {
+		if err := b.push([]byte(request)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Only the two newest requests fit in 11 bytes.
+	if dropped != 1 || b.len() != 2 {
+		t.Errorf("expected 1 dropped and 2 buffered requests, got %d and %d", dropped, b.len())
+	}
+
+	// Buffered requests survive reopening.
+	b, err = newDiskBuffer(dir, 11, func(count int) { dropped += count })
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{"second", "third", ""} {
+		sequence, request, err := b.peek()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(request) != expected {
+			t.Errorf("expected %q, got %q", expected, request)
+		}
+		if err := b.pop(sequence); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// Requests queued while another is being sent are not removed in its
+// place if it is dropped to make room for them.
+func TestBufferFilledDuringSend(t *testing.T) {
+	for _, name := range []string{"memory", "disk"} {
+		var mu sync.Mutex
+		var received []string
+		sending := make(chan struct{})
+		release := make(chan struct{})
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			mu.Lock()
+			received = append(received, string(body))
+			first := len(received) == 1
+			mu.Unlock()
+			if first {
+				close(sending)
+				<-release
+			}
+		}))
+
+		client, err := NewClient(Config{
+			URL:            server.URL,
+			QueueSize:      2,
+			BufferMaxBytes: 2 * int64(len("request 0")),
+			MinBackoff:     time.Millisecond,
+			MaxBackoff:     time.Millisecond,
+			Timeout:        time.Second,
+		}, prometheus.NewRegistry())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if name == "disk" {
+			client.buffer, err = newDiskBuffer(t.TempDir(), 2*int64(len("request 0")), func(int) {})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := client.buffer.push([]byte("request 0")); err != nil {
+			t.Fatal(err)
+		}
+		done := make(chan struct{})
+		go func() {
+			client.flush(context.Background())
+			close(done)
+		}()
+		<-sending
+		// The request being sent is dropped from the full buffer.
+		for _, request := range []string{"request 1", "request 2"} {
+			if err := client.buffer.push([]byte(request)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		close(release)
+		<-done
+		server.Close()
+
+		expected := []string{"request 0", "request 1", "request 2"}
+		if !reflect.DeepEqual(received, expected) {
+			t.Errorf("%s: expected %q to be sent, got %q", name, expected, received)
+		}
+	}
+}
+
+// Empty labels are left out, so that they do not override external
+// labels either.
+func TestEmptyLabels(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	up := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "openvpn_up", Help: "Up."}, []string{"instance", "status_path", "username"})
+	up.WithLabelValues("", "/run/server.status", "").Set(1)
+	registry.MustRegister(up)
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	series := toTimeSeries(families, map[string]string{"instance": "gw1", "site": ""}, 0)
+	expected := []label{
+		{"__name__", "openvpn_up"},
+		{"instance", "gw1"},
+		{"status_path", "/run/server.status"},
+	}
+	if len(series) != 1 || !reflect.DeepEqual(series[0].labels, expected) {
+		t.Errorf("expected labels %v, got %v", expected, series)
+	}
+}
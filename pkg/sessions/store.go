@@ -0,0 +1,171 @@
+package sessions
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/kumina/openvpn_exporter/pkg/exporters"
+
+	// Pure Go SQLite driver, as the exporter is built without cgo.
+	_ "modernc.org/sqlite"
+)
+
+const schema = `
+CREATE TABLE IF NOT EXISTS sessions (
+	id INTEGER PRIMARY KEY,
+	instance TEXT NOT NULL,
+	status_path TEXT NOT NULL,
+	session_key TEXT NOT NULL,
+	common_name TEXT NOT NULL,
+	username TEXT NOT NULL,
+	real_address TEXT NOT NULL,
+	virtual_address TEXT NOT NULL,
+	start_time INTEGER NOT NULL,
+	last_seen INTEGER NOT NULL,
+	end_time INTEGER,
+	bytes_received INTEGER NOT NULL,
+	bytes_sent INTEGER NOT NULL,
+	UNIQUE (status_path, session_key)
+);
+CREATE INDEX IF NOT EXISTS sessions_start_time ON sessions (start_time);
+`
+
+// SQLite database of client sessions, recording for every session when
+// it started and ended, and how much traffic it carried.
+type Store struct {
+	db *sql.DB
+}
+
+// Opens the database at the given path, creating it if needed.
+func Open(path string) (*Store, error) {
+	db, err := sql.Open("sqlite", "file:"+path+"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)")
+	if err != nil {
+		return nil, err
+	}
+	// SQLite allows a single writer only.
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(schema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create session database %s: %s", path, err)
+	}
+	return &Store{db: db}, nil
+}
+
+// Opens the existing database at the given path for reading only, e.g. to
+// report on it while the exporter records sessions.
+func OpenReadOnly(path string) (*Store, error) {
+	db, err := sql.Open("sqlite", "file:"+path+"?mode=ro&_pragma=busy_timeout(5000)")
+	if err != nil {
+		return nil, err
+	}
+	// Opening is deferred until the first query, so errors such as a
+	// missing file are reported here.
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to open session database %s: %s", path, err)
+	}
+	return &Store{db: db}, nil
+}
+
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// Records the clients connected to a server at the given time. Sessions
+// seen before are updated with their latest traffic counters. Sessions
+// of the server that are no longer connected are ended at the time they
+// were last seen, so their duration is accurate to the polling interval.
+func (s *Store) Record(source exporters.StatusSource, clients []exporters.Client, now time.Time) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, client := range clients {
+		_, err := tx.Exec(`
+			INSERT INTO sessions (instance, status_path, session_key, common_name, username, real_address, virtual_address, start_time, last_seen, bytes_received, bytes_sent)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			ON CONFLICT (status_path, session_key) DO UPDATE SET
+				virtual_address = excluded.virtual_address,
+				last_seen = excluded.last_seen,
+				end_time = NULL,
+				bytes_received = excluded.bytes_received,
+				bytes_sent = excluded.bytes_sent`,
+			source.Instance, source.StatusPath, client.SessionKey(), client.CommonName, client.Username,
+			client.RealAddress, client.VirtualAddress, client.ConnectedSince.Unix(), now.Unix(),
+			int64(client.BytesReceived), int64(client.BytesSent))
+		if err != nil {
+			return fmt.Errorf("failed to record session of %s: %s", client.CommonName, err)
+		}
+	}
+	if err := endSessions(tx, source, now); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Ends the open sessions of a server that have not been seen since the
+// given time, e.g. because the server has not been readable since. They
+// are reopened if the server turns out to still list them.
+func (s *Store) EndStale(source exporters.StatusSource, seenBefore time.Time) error {
+	return endSessions(s.db, source, seenBefore)
+}
+
+// Database or transaction to run statements in.
+type execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+func endSessions(db execer, source exporters.StatusSource, seenBefore time.Time) error {
+	_, err := db.Exec(`
+		UPDATE sessions SET end_time = last_seen
+		WHERE status_path = ? AND end_time IS NULL AND last_seen < ?`,
+		source.StatusPath, seenBefore.Unix())
+	if err != nil {
+		return fmt.Errorf("failed to end sessions: %s", err)
+	}
+	return nil
+}
+
+// Traffic and connection time of a user over a period.
+type Usage struct {
+	CommonName    string
+	Username      string
+	Sessions      int
+	Duration      time.Duration
+	BytesReceived int64
+	BytesSent     int64
+}
+
+// Aggregates the sessions that started in [from, to) per common name
+// and username. Sessions are attributed to the period in which they
+// started as a whole, so that sessions spanning periods are not counted
+// twice. Sessions that have not ended yet count up to when they were
+// last seen.
+func (s *Store) Report(from time.Time, to time.Time) ([]Usage, error) {
+	rows, err := s.db.Query(`
+		SELECT common_name, username, COUNT(*),
+			SUM(COALESCE(end_time, last_seen) - start_time),
+			SUM(bytes_received), SUM(bytes_sent)
+		FROM sessions
+		WHERE start_time >= ? AND start_time < ?
+		GROUP BY common_name, username
+		ORDER BY common_name, username`,
+		from.Unix(), to.Unix())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var usages []Usage
+	for rows.Next() {
+		var usage Usage
+		var seconds int64
+		if err := rows.Scan(&usage.CommonName, &usage.Username, &usage.Sessions, &seconds, &usage.BytesReceived, &usage.BytesSent); err != nil {
+			return nil, err
+		}
+		usage.Duration = time.Duration(seconds) * time.Second
+		usages = append(usages, usage)
+	}
+	return usages, rows.Err()
+}
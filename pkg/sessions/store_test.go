@@ -0,0 +1,123 @@
+package sessions
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/kumina/openvpn_exporter/pkg/exporters"
+)
+
+func TestStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sessions.db")
+	store, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	source := exporters.StatusSource{StatusPath: "/run/openvpn/server.status"}
+	start := time.Date(2024, 9, 1, 10, 0, 0, 0, time.UTC)
+	alice := exporters.Client{CommonName: "alice", Username: "alice", RealAddress: "192.0.2.1:1194", ConnectedSince: start}
+	bob := exporters.Client{CommonName: "bob", RealAddress: "192.0.2.2:1194", ConnectedSince: start.Add(30 * time.Minute)}
+
+	alice.BytesReceived, alice.BytesSent = 100, 200
+	if err := store.Record(source, []exporters.Client{alice}, start.Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	alice.BytesReceived, alice.BytesSent = 1000, 2000
+	bob.BytesReceived, bob.BytesSent = 10, 20
+	if err := store.Record(source, []exporters.Client{alice, bob}, start.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	// Alice disconnects and reconnects, starting a second session.
+	alice.ConnectedSince = start.Add(90 * time.Minute)
+	alice.BytesReceived, alice.BytesSent = 5, 5
+	if err := store.Record(source, []exporters.Client{alice, bob}, start.Add(2*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	store.Close()
+
+	// Sessions survive reopening the database, which can be read while
+	// it is open for writing elsewhere.
+	writer, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer writer.Close()
+	store, err = OpenReadOnly(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	usages, err := store.Report(start, start.Add(24*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Usage{
+		{CommonName: "alice", Username: "alice", Sessions: 2, Duration: time.Hour + 30*time.Minute, BytesReceived: 1005, BytesSent: 2005},
+		{CommonName: "bob", Sessions: 1, Duration: 90 * time.Minute, BytesReceived: 10, BytesSent: 20},
+	}
+	if !reflect.DeepEqual(usages, expected) {
+		t.Errorf("expected %+v, got %+v", expected, usages)
+	}
+
+	// Sessions are attributed to the period in which they started.
+	usages, err = store.Report(start.Add(time.Hour), start.Add(24*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(usages) != 1 || usages[0].CommonName != "alice" || usages[0].Sessions != 1 {
+		t.Errorf("expected only the second session of alice, got %+v", usages)
+	}
+}
+
+func TestOpenReadOnlyMissing(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sessions.db")
+	if _, err := OpenReadOnly(path); err == nil {
+		t.Fatal("expected error opening a missing database")
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("expected database not to be created, got %v", err)
+	}
+}
+
+// Sessions of a server that cannot be read are ended once they have not
+// been seen for a few poll intervals, and reopened if it lists them again.
+func TestTrackerEndsStaleSessions(t *testing.T) {
+	store, err := Open(filepath.Join(t.TempDir(), "sessions.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	source := exporters.StatusSource{StatusPath: filepath.Join(t.TempDir(), "missing.status")}
+	start := time.Date(2024, 9, 1, 10, 0, 0, 0, time.UTC)
+	alice := exporters.Client{CommonName: "alice", RealAddress: "192.0.2.1:1194", ConnectedSince: start}
+	if err := store.Record(source, []exporters.Client{alice}, start); err != nil {
+		t.Fatal(err)
+	}
+	tracker := NewTracker(store, []exporters.StatusSource{source}, time.Minute)
+
+	endTime := func() sql.NullInt64 {
+		var end sql.NullInt64
+		if err := store.db.QueryRow("SELECT end_time FROM sessions").Scan(&end); err != nil {
+			t.Fatal(err)
+		}
+		return end
+	}
+	tracker.poll(start.Add(staleIntervals * time.Minute))
+	if end := endTime(); end.Valid {
+		t.Errorf("expected session to stay open, got end time %d", end.Int64)
+	}
+	tracker.poll(start.Add(staleIntervals*time.Minute + time.Second))
+	if end := endTime(); !end.Valid || end.Int64 != start.Unix() {
+		t.Errorf("expected session to end at %d, got %+v", start.Unix(), end)
+	}
+	if err := store.Record(source, []exporters.Client{alice}, start.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if end := endTime(); end.Valid {
+		t.Errorf("expected session to be reopened, got end time %d", end.Int64)
+	}
+}
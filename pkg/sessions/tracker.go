@@ -0,0 +1,58 @@
+package sessions
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/kumina/openvpn_exporter/pkg/exporters"
+)
+
+// Number of poll intervals after which the sessions of a server that
+// cannot be read are ended, so that they do not stay open forever when it
+// has gone away.
+const staleIntervals = 3
+
+// Periodically records the client lists of servers in a store.
+type Tracker struct {
+	store        *Store
+	sources      []exporters.StatusSource
+	pollInterval time.Duration
+}
+
+func NewTracker(store *Store, sources []exporters.StatusSource, pollInterval time.Duration) *Tracker {
+	return &Tracker{store: store, sources: sources, pollInterval: pollInterval}
+}
+
+// Records the current client list of every source. Sessions of sources
+// that cannot be read stay open until they have not been seen for a few
+// poll intervals.
+func (t *Tracker) poll(now time.Time) {
+	for _, source := range t.sources {
+		clients, err := exporters.ReadClientList(source)
+		if err != nil {
+			slog.Warn("Failed to read client list for session store", "status_path", source.StatusPath, "err", err)
+			if err := t.store.EndStale(source, now.Add(-staleIntervals*t.pollInterval)); err != nil {
+				slog.Error("Failed to end stale sessions", "status_path", source.StatusPath, "err", err)
+			}
+			continue
+		}
+		if err := t.store.Record(source, clients, now); err != nil {
+			slog.Error("Failed to record sessions", "status_path", source.StatusPath, "err", err)
+		}
+	}
+}
+
+// Records sessions until the context is cancelled.
+func (t *Tracker) Run(ctx context.Context) {
+	ticker := time.NewTicker(t.pollInterval)
+	defer ticker.Stop()
+	for {
+		t.poll(time.Now())
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
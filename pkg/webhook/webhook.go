@@ -0,0 +1,367 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"regexp"
+	"text/template"
+	"time"
+
+	"github.com/kumina/openvpn_exporter/pkg/config"
+	"github.com/kumina/openvpn_exporter/pkg/exporters"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	Connect    = "connect"
+	Disconnect = "disconnect"
+)
+
+// Number of events waiting for delivery to a webhook, beyond which new
+// events are dropped.
+const queueSize = 1000
+
+// Client connecting to or disconnecting from a server. Disconnect events
+// carry the traffic counters last observed for the session.
+type Event struct {
+	Type           string    `json:"event"`
+	Time           time.Time `json:"time"`
+	Instance       string    `json:"instance,omitempty"`
+	StatusPath     string    `json:"status_path"`
+	CommonName     string    `json:"common_name"`
+	RealAddress    string    `json:"real_address"`
+	VirtualAddress string    `json:"virtual_address,omitempty"`
+	Username       string    `json:"username,omitempty"`
+	ConnectedSince time.Time `json:"connected_since"`
+	BytesReceived  float64   `json:"bytes_received"`
+	BytesSent      float64   `json:"bytes_sent"`
+}
+
+func newEvent(eventType string, now time.Time, source exporters.StatusSource, client exporters.Client) Event {
+	return Event{
+		Type:           eventType,
+		Time:           now,
+		Instance:       source.Instance,
+		StatusPath:     source.StatusPath,
+		CommonName:     client.CommonName,
+		RealAddress:    client.RealAddress,
+		VirtualAddress: client.VirtualAddress,
+		Username:       client.Username,
+		ConnectedSince: client.ConnectedSince,
+		BytesReceived:  client.BytesReceived,
+		BytesSent:      client.BytesSent,
+	}
+}
+
+// Webhook along with the queue of events waiting to be delivered to it.
+type Hook struct {
+	name        string
+	url         string
+	events      map[string]bool
+	commonNames []*regexp.Regexp
+	template    *template.Template
+	contentType string
+	headers     map[string]string
+	secret      []byte
+	retries     int
+	backoff     time.Duration
+	client      *http.Client
+	queue       chan Event
+}
+
+var templateFuncs = template.FuncMap{
+	// Quotes a value for use in JSON payloads.
+	"json": func(value interface{}) (string, error) {
+		encoded, err := json.Marshal(value)
+		return string(encoded), err
+	},
+}
+
+func NewHook(c config.WebhookConfig) (*Hook, error) {
+	hook := &Hook{
+		name:        c.Name,
+		url:         c.URL,
+		events:      map[string]bool{},
+		contentType: c.ContentType,
+		headers:     c.Headers,
+		retries:     3,
+		backoff:     time.Second,
+		client:      &http.Client{Timeout: c.Timeout},
+		queue:       make(chan Event, queueSize),
+	}
+	if len(c.Events) == 0 {
+		c.Events = []string{Connect, Disconnect}
+	}
+	for _, event := range c.Events {
+		if event != Connect && event != Disconnect {
+			return nil, fmt.Errorf("webhook %s: unknown event %q", c.Name, event)
+		}
+		hook.events[event] = true
+	}
+	for _, pattern := range c.CommonNames {
+		commonName, err := regexp.Compile("^(?:" + pattern + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("webhook %s: invalid common name pattern: %s", c.Name, err)
+		}
+		hook.commonNames = append(hook.commonNames, commonName)
+	}
+	if c.Template != "" {
+		tmpl, err := template.New(c.Name).Funcs(templateFuncs).Parse(c.Template)
+		if err != nil {
+			return nil, fmt.Errorf("webhook %s: invalid template: %s", c.Name, err)
+		}
+		hook.template = tmpl
+	}
+	if hook.contentType == "" {
+		hook.contentType = "application/json"
+	}
+	if c.SecretFile != "" {
+		secret, err := os.ReadFile(c.SecretFile)
+		if err != nil {
+			return nil, fmt.Errorf("webhook %s: failed to read secret: %s", c.Name, err)
+		}
+		hook.secret = bytes.TrimSpace(secret)
+	}
+	if c.Retries != nil {
+		hook.retries = *c.Retries
+	}
+	if hook.client.Timeout == 0 {
+		hook.client.Timeout = 10 * time.Second
+	}
+	return hook, nil
+}
+
+// Reports whether the webhook wants to be notified of an event.
+func (h *Hook) matches(event Event) bool {
+	if !h.events[event.Type] {
+		return false
+	}
+	if len(h.commonNames) == 0 {
+		return true
+	}
+	for _, commonName := range h.commonNames {
+		if commonName.MatchString(event.CommonName) {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *Hook) render(event Event) ([]byte, error) {
+	if h.template == nil {
+		return json.Marshal(event)
+	}
+	var body bytes.Buffer
+	if err := h.template.Execute(&body, event); err != nil {
+		return nil, err
+	}
+	return body.Bytes(), nil
+}
+
+// Sends a request to the webhook. If a secret is configured, the body is
+// signed with HMAC-SHA256 in the X-Signature-256 header, in the same
+// format as GitHub uses.
+func (h *Hook) send(ctx context.Context, body []byte) error {
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, h.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", h.contentType)
+	request.Header.Set("User-Agent", "openvpn_exporter")
+	for name, value := range h.headers {
+		request.Header.Set(name, value)
+	}
+	if h.secret != nil {
+		mac := hmac.New(sha256.New, h.secret)
+		mac.Write(body)
+		request.Header.Set("X-Signature-256", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+	response, err := h.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode/100 != 2 {
+		responseBody, _ := io.ReadAll(io.LimitReader(response.Body, 512))
+		return fmt.Errorf("server returned %s: %s", response.Status, bytes.TrimSpace(responseBody))
+	}
+	_, _ = io.Copy(io.Discard, response.Body)
+	return nil
+}
+
+// Delivers an event, retrying with exponential backoff.
+func (h *Hook) deliver(ctx context.Context, event Event) error {
+	body, err := h.render(event)
+	if err != nil {
+		return fmt.Errorf("failed to render payload: %s", err)
+	}
+	backoff := h.backoff
+	for attempt := 0; ; attempt++ {
+		err = h.send(ctx, body)
+		if err == nil || attempt >= h.retries {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// Watches the client lists of servers and notifies webhooks of clients
+// connecting and disconnecting, by comparing successive snapshots.
+type Notifier struct {
+	sources      []exporters.StatusSource
+	hooks        []*Hook
+	pollInterval time.Duration
+	// Sessions seen in the last successful read of every source.
+	snapshots     map[string]map[string]exporters.Client
+	notifications *prometheus.CounterVec
+}
+
+func NewNotifier(sources []exporters.StatusSource, configs []config.WebhookConfig, pollInterval time.Duration) (*Notifier, error) {
+	var hooks []*Hook
+	for _, c := range configs {
+		hook, err := NewHook(c)
+		if err != nil {
+			return nil, err
+		}
+		hooks = append(hooks, hook)
+	}
+	notifications := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: prometheus.BuildFQName("openvpn", "webhook", "notifications_total"),
+		Help: "Number of webhook notifications, by result (delivered, failed or dropped).",
+	}, []string{"webhook", "result"})
+	for _, hook := range hooks {
+		for _, result := range []string{"delivered", "failed", "dropped"} {
+			notifications.WithLabelValues(hook.name, result)
+		}
+	}
+	return &Notifier{
+		sources:       sources,
+		hooks:         hooks,
+		pollInterval:  pollInterval,
+		snapshots:     map[string]map[string]exporters.Client{},
+		notifications: notifications,
+	}, nil
+}
+
+// Compares two snapshots of a client list, returning the sessions that
+// have started and ended in between.
+func diff(previous map[string]exporters.Client, current map[string]exporters.Client) ([]exporters.Client, []exporters.Client) {
+	var connected, disconnected []exporters.Client
+	for key, client := range current {
+		if _, ok := previous[key]; !ok {
+			connected = append(connected, client)
+		}
+	}
+	for key, client := range previous {
+		if _, ok := current[key]; !ok {
+			disconnected = append(disconnected, client)
+		}
+	}
+	return connected, disconnected
+}
+
+// Reads the client lists of all sources and returns the events since the
+// previous poll. The first successful read of a source only establishes
+// which clients are connected, so that restarting the exporter does not
+// send a connect event for every client. Sources that cannot be read are
+// skipped, instead of reporting all of their clients as disconnected.
+func (n *Notifier) poll(now time.Time) []Event {
+	var events []Event
+	for _, source := range n.sources {
+		clients, err := exporters.ReadClientList(source)
+		if err != nil {
+			slog.Warn("Failed to read client list for webhooks", "status_path", source.StatusPath, "err", err)
+			continue
+		}
+		current := map[string]exporters.Client{}
+		for _, client := range clients {
+			current[client.SessionKey()] = client
+		}
+		previous, ok := n.snapshots[source.StatusPath]
+		n.snapshots[source.StatusPath] = current
+		if !ok {
+			continue
+		}
+		connected, disconnected := diff(previous, current)
+		for _, client := range disconnected {
+			events = append(events, newEvent(Disconnect, now, source, client))
+		}
+		for _, client := range connected {
+			events = append(events, newEvent(Connect, now, source, client))
+		}
+	}
+	return events
+}
+
+// Queues an event for delivery to all matching webhooks.
+func (n *Notifier) notify(event Event) {
+	for _, hook := range n.hooks {
+		if !hook.matches(event) {
+			continue
+		}
+		select {
+		case hook.queue <- event:
+		default:
+			slog.Warn("Webhook queue is full, dropping event", "webhook", hook.name, "event", event.Type, "common_name", event.CommonName)
+			n.notifications.WithLabelValues(hook.name, "dropped").Inc()
+		}
+	}
+}
+
+func (n *Notifier) Describe(ch chan<- *prometheus.Desc) {
+	n.notifications.Describe(ch)
+}
+
+func (n *Notifier) Collect(ch chan<- prometheus.Metric) {
+	n.notifications.Collect(ch)
+}
+
+// Polls the sources and delivers events until the context is cancelled.
+// Every webhook is served by its own goroutine, so a slow webhook does
+// not delay the others.
+func (n *Notifier) Run(ctx context.Context) {
+	for _, hook := range n.hooks {
+		go func(hook *Hook) {
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case event := <-hook.queue:
+					if err := hook.deliver(ctx, event); err != nil {
+						slog.Warn("Failed to notify webhook", "webhook", hook.name, "event", event.Type, "common_name", event.CommonName, "err", err)
+						n.notifications.WithLabelValues(hook.name, "failed").Inc()
+					} else {
+						n.notifications.WithLabelValues(hook.name, "delivered").Inc()
+					}
+				}
+			}
+		}(hook)
+	}
+
+	ticker := time.NewTicker(n.pollInterval)
+	defer ticker.Stop()
+	for {
+		for _, event := range n.poll(time.Now()) {
+			n.notify(event)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package webhook
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kumina/openvpn_exporter/pkg/config"
+	"github.com/kumina/openvpn_exporter/pkg/exporters"
+)
+
+const statusHeader = "TITLE,OpenVPN 2.6.12\nTIME,Tue Mar 21 10:39:14 2017,1490089154\nHEADER,CLIENT_LIST,Common Name,Real Address,Virtual Address,Bytes Received,Bytes Sent,Connected Since,Connected Since (time_t),Username\n"
+
+func TestNotifierPoll(t *testing.T) {
+	statusPath := filepath.Join(t.TempDir(), "server.status")
+	writeStatus := func(rows string) {
+		if err := os.WriteFile(statusPath, []byte(statusHeader+rows+"END\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	notifier, err := NewNotifier([]exporters.StatusSource{{StatusPath: statusPath}}, nil, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The first poll only records the connected clients.
+	writeStatus("CLIENT_LIST,alice,192.0.2.1:1194,10.8.0.2,100,200,Tue Mar 21 10:00:00 2017,1490086800,UNDEF\n")
+	if events := notifier.poll(time.Now()); len(events) != 0 {
+		t.Fatalf("expected no events, got %v", events)
+	}
+
+	writeStatus("CLIENT_LIST,alice,192.0.2.1:1194,10.8.0.2,300,400,Tue Mar 21 10:00:00 2017,1490086800,UNDEF\n" +
+		"CLIENT_LIST,bob,192.0.2.2:1194,10.8.0.3,0,0,Tue Mar 21 10:30:00 2017,1490088600,UNDEF\n")
+	events := notifier.poll(time.Now())
+	if len(events) != 1 || events[0].Type != Connect || events[0].CommonName != "bob" {
+		t.Fatalf("expected a connect event for bob, got %v", events)
+	}
+
+	// Unreadable status files do not disconnect anyone.
+	os.Remove(statusPath)
+	if events := notifier.poll(time.Now()); len(events) != 0 {
+		t.Fatalf("expected no events, got %v", events)
+	}
+
+	writeStatus("CLIENT_LIST,bob,192.0.2.2:1194,10.8.0.3,0,0,Tue Mar 21 10:30:00 2017,1490088600,UNDEF\n")
+	events = notifier.poll(time.Now())
+	if len(events) != 1 || events[0].Type != Disconnect || events[0].CommonName != "alice" || events[0].BytesReceived != 300 {
+		t.Fatalf("expected a disconnect event for alice, got %v", events)
+	}
+}
+
+func TestHookDeliver(t *testing.T) {
+	secretPath := filepath.Join(t.TempDir(), "secret")
+	if err := os.WriteFile(secretPath, []byte("s3cret\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	failures := 1
+	var body []byte
+	var signature string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failures > 0 {
+			failures--
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		body, _ = io.ReadAll(r.Body)
+		signature = r.Header.Get("X-Signature-256")
+	}))
+	defer server.Close()
+
+	hook, err := NewHook(config.WebhookConfig{
+		Name:        "slack",
+		URL:         server.URL,
+		Events:      []string{Connect},
+		CommonNames: []string{"admin-.*"},
+		Template:    `{"text": {{ json (printf "%s connected from %s" .CommonName .RealAddress) }}}`,
+		SecretFile:  secretPath,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	hook.backoff = time.Millisecond
+
+	event := Event{Type: Connect, CommonName: "admin-\"jane\"", RealAddress: "192.0.2.1:1194"}
+	if !hook.matches(event) {
+		t.Error("expected event to match")
+	}
+	if hook.matches(Event{Type: Connect, CommonName: "contractor-joe"}) || hook.matches(Event{Type: Disconnect, CommonName: "admin-jane"}) {
+		t.Error("expected events not to match")
+	}
+	if err := hook.deliver(context.Background(), event); err != nil {
+		t.Fatal(err)
+	}
+	if expected := `{"text": "admin-\"jane\" connected from 192.0.2.1:1194"}`; string(body) != expected {
+		t.Errorf("expected body %s, got %s", expected, body)
+	}
+	mac := hmac.New(sha256.New, []byte("s3cret"))
+	mac.Write(body)
+	if expected := "sha256=" + hex.EncodeToString(mac.Sum(nil)); signature != expected {
+		t.Errorf("expected signature %s, got %s", expected, signature)
+	}
+}